@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/maciakl/mdwi/wiki"
+)
+
+// the flags taking a value, so their values are not mistaken for commands
+var valueFlags = map[string]bool{"--src": true, "-src": true, "--out": true, "-out": true, "-o": true, "--o": true, "--port": true, "-port": true, "--title": true, "-title": true, "--theme": true, "-theme": true, "-j": true, "--j": true}
+
+// get the function running a command, nil if there is no such command
+// the shortcuts of the old command line still work
+func commandFunc(name string) func(args []string) {
+	switch name {
+	case "build":
+		return cmdBuild
+	case "standalone", "-s", "--standalone":
+		return cmdStandalone
+	case "serve":
+		return cmdServe
+	case "check":
+		return cmdCheck
+	case "new":
+		return cmdNew
+	case "version", "-v", "--version":
+		return cmdVersion
+	case "help", "-h", "--help":
+		return cmdHelp
+	}
+	return nil
+}
+
+// run the command given on the command line, building the wiki if there is none
+func runCommand(args []string) {
+
+	if len(args) == 0 {
+		cmdBuild(nil)
+		return
+	}
+
+	// options can come before the command, e.g. mdwi --src docs serve
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "-") && commandFunc(arg) == nil {
+			continue
+		}
+		if i > 0 && valueFlags[args[i-1]] {
+			continue
+		}
+		run := commandFunc(arg)
+		if run == nil {
+			if i == 0 {
+				fmt.Fprintln(os.Stderr, "Error: unknown command", arg)
+				printUsage(os.Stderr)
+				os.Exit(2)
+			}
+			break // an argument of the build command, reported when parsing it
+		}
+		run(append(args[:i:i], args[i+1:]...))
+		return
+	}
+
+	// only options, e.g. mdwi --strict
+	cmdBuild(args)
+}
+
+// create the flag set of a command
+func newFlagSet(name string, arguments string, summary string) *flag.FlagSet {
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), strings.TrimSpace(fmt.Sprintf("Usage: %s %s [options] %s", filepath.Base(os.Args[0]), name, arguments)))
+		fmt.Fprintln(fs.Output(), summary)
+		fmt.Fprintln(fs.Output(), "Options:")
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse the options of a command, which can come before or after its other
+// arguments, and return the other arguments
+// misuse exits with code 2, after printing the error and the usage of the command
+func parseFlags(fs *flag.FlagSet, args []string, minArgs int, maxArgs int) []string {
+
+	var positional []string
+	for {
+		err := fs.Parse(args)
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		if err != nil {
+			os.Exit(2)
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+
+		// everything after -- is an argument
+		rest := fs.Args()
+		if len(args) > len(rest) && args[len(args)-len(rest)-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+
+	if len(positional) < minArgs || len(positional) > maxArgs {
+		if len(positional) < minArgs {
+			fmt.Fprintln(fs.Output(), "Error: missing arguments")
+		} else {
+			fmt.Fprintln(fs.Output(), "Error: unexpected arguments:", strings.Join(positional[maxArgs:], " "))
+		}
+		fs.Usage()
+		os.Exit(2)
+	}
+	return positional
+}
+
+// create the builder for the wiki in the source directory, printing to the
+// console, the out option takes precedence over the config file
+func setup(src string, out string) *wiki.Builder {
+
+	b, err := wiki.NewBuilder(src, out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	b.Log = os.Stdout
+	b.Warn = os.Stderr
+
+	if b.ConfigFile != "" {
+		fmt.Println("Using config file", b.ConfigFile)
+	}
+	return b
+}
+
+// add the --theme option to a command
+func themeFlag(fs *flag.FlagSet) *string {
+	return fs.String("theme", "", "color `theme` of the default stylesheet: "+strings.Join(wiki.Themes(), ", ")+" (default "+wiki.DefaultTheme+")")
+}
+
+// add the -j option to a command
+func jobsFlag(fs *flag.FlagSet) *int {
+	return fs.Int("j", 0, "render `n` pages at the same time (default the number of CPUs)")
+}
+
+// add the --verbose option to a command
+func verboseFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("verbose", false, "report which pages are taken from the build cache and which are rendered")
+}
+
+// use the theme given on the command line instead of the one in the config file
+func setTheme(b *wiki.Builder, theme string) {
+	if theme != "" {
+		b.Config.Theme = theme
+	}
+}
+
+// print an error returned by the builder and exit
+func fail(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func cmdBuild(args []string) {
+
+	fs := newFlagSet("build", "", "Build the wiki into the output directory.")
+	src := fs.String("src", ".", "read the markdown files from `dir`")
+	out := fs.String("out", "", "write the site to `dir` (default <src>/_site)")
+	strict := fs.Bool("strict", false, "exit with an error if any wiki links are broken")
+	watch := fs.Bool("watch", false, "rebuild the wiki whenever the source files change")
+	clean := fs.Bool("clean", false, "remove all the files generated by the previous build first")
+	theme := themeFlag(fs)
+	jobs := jobsFlag(fs)
+	verbose := verboseFlag(fs)
+	keepGoing := fs.Bool("keep-going", false, "write the site even if some pages fail, keeping their previous version")
+	parseFlags(fs, args, 0, 0)
+
+	b := setup(*src, *out)
+	setTheme(b, *theme)
+	b.Clean = *clean
+	b.Jobs = *jobs
+	b.Verbose = *verbose
+	b.KeepGoing = *keepGoing
+
+	if *watch {
+		fail(b.Watch())
+		return
+	}
+
+	report, err := b.Build()
+	fail(err)
+	if *strict && len(report.Broken) > 0 {
+		fmt.Fprintln(os.Stderr, "Error (strict): broken wiki links found")
+		os.Exit(1)
+	}
+	fmt.Println("Done!")
+}
+
+func cmdStandalone(args []string) {
+
+	fs := newFlagSet("standalone", "<file>", "Create a standalone HTML file from a markdown file.")
+	src := fs.String("src", ".", "read the other pages of the wiki from `dir`")
+	output := fs.String("o", "", "write the HTML file to `file` (default _site/index.html)")
+	follow := fs.Bool("follow", false, "include every page linked from the file")
+	theme := themeFlag(fs)
+	inputFile := parseFlags(fs, args, 1, 1)[0]
+
+	b := setup(*src, "")
+	setTheme(b, *theme)
+
+	if *follow {
+		fail(b.StandaloneFollow(inputFile, *output))
+	} else {
+		fail(b.Standalone(inputFile, *output))
+	}
+}
+
+func cmdServe(args []string) {
+
+	fs := newFlagSet("serve", "[port]", "Serve the wiki on localhost, rebuilding and reloading it whenever the source files change.")
+	src := fs.String("src", ".", "read the markdown files from `dir`")
+	out := fs.String("out", "", "write the site to `dir` (default <src>/_site)")
+	port := fs.String("port", wiki.DefaultPort, "serve the wiki on `port`")
+	theme := themeFlag(fs)
+	jobs := jobsFlag(fs)
+	verbose := verboseFlag(fs)
+	positional := parseFlags(fs, args, 0, 1)
+
+	// the port can also be given as an argument, as in older versions
+	if len(positional) > 0 {
+		*port = positional[0]
+	}
+
+	b := setup(*src, *out)
+	setTheme(b, *theme)
+	b.Jobs = *jobs
+	b.Verbose = *verbose
+	fail(b.Serve(*port))
+}
+
+func cmdCheck(args []string) {
+
+	fs := newFlagSet("check", "", "Check the front matter and the wiki links of all the pages without building the wiki.")
+	src := fs.String("src", ".", "read the markdown files from `dir`")
+	parseFlags(fs, args, 0, 0)
+
+	b := setup(*src, "")
+
+	report, err := b.Check()
+	fail(err)
+	if len(report.Broken) > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("Checked", report.Pages, "page(s), no broken links found")
+}
+
+func cmdNew(args []string) {
+
+	fs := newFlagSet("new", "<page>", "Create a new page, e.g. mdwi new notes/ideas creates notes/ideas.md.")
+	src := fs.String("src", ".", "create the page in `dir`")
+	title := fs.String("title", "", "the `title` of the page (default the page name)")
+	name := parseFlags(fs, args, 1, 1)[0]
+
+	b := setup(*src, "")
+
+	_, err := b.NewPage(name, *title)
+	fail(err)
+}
+
+func cmdVersion(args []string) {
+
+	fs := newFlagSet("version", "", "Print version information.")
+	parseFlags(fs, args, 0, 0)
+
+	Version()
+}
+
+func cmdHelp(args []string) {
+
+	if len(args) == 0 || args[0] == "help" {
+		Usage()
+	}
+
+	// print the usage of the command, by asking it for help
+	run := commandFunc(args[0])
+	if run == nil || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, "Error: unknown command", args[0])
+		printUsage(os.Stderr)
+		os.Exit(2)
+	}
+	run([]string{"-h"})
+}
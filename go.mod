@@ -3,12 +3,8 @@ module github.com/maciakl/mdwi
 go 1.21.0
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/gomarkdown/markdown v0.0.0-20260614204949-e08cff860f76
-	github.com/otiai10/copy v1.14.1
-)
-
-require (
-	github.com/otiai10/mint v1.6.3 // indirect
-	golang.org/x/sync v0.8.0 // indirect
-	golang.org/x/sys v0.24.0 // indirect
+	golang.org/x/sys v0.24.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -117,6 +124,9 @@ func TestNoArgs(t *testing.T) {
 	if !strings.Contains(string(indexContent), `<a href="another.html">another</a>`) {
 		t.Errorf("Link was not replaced in index.html")
 	}
+	if strings.Contains(string(indexContent), "EventSource") {
+		t.Errorf("Live reload script should only be injected in serve mode")
+	}
 }
 
 func TestVersionFlag(t *testing.T) {
@@ -223,3 +233,1538 @@ func TestInternalLinks(t *testing.T) {
 	}
 }
 
+
+func TestSubdirectories(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Create a nested wiki with links between folders
+	err := os.MkdirAll(filepath.Join(tmpDir, "notes", "deep"), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create subdirectories: %v", err)
+	}
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\nLink to {{notes/foo}}.")
+	createDummyFile(t, filepath.Join(tmpDir, "notes", "foo.md"), "# Foo\n\nLink to {{deep/bar}} and {{index}}.\n\n![pic](pic.png)")
+	createDummyFile(t, filepath.Join(tmpDir, "notes", "deep", "bar.md"), "# Bar\n\nBack to {{/notes/foo}}.")
+	createDummyFile(t, filepath.Join(tmpDir, "notes", "pic.png"), "dummy image content")
+
+	cmd := exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	siteDir := filepath.Join(tmpDir, expectedSite)
+	for _, file := range []string{"index.html", "notes/foo.html", "notes/deep/bar.html", "notes/pic.png"} {
+		if _, err := os.Stat(filepath.Join(siteDir, file)); os.IsNotExist(err) {
+			t.Errorf("Expected file %s was not created in _site", file)
+		}
+	}
+
+	fooContent, err := os.ReadFile(filepath.Join(siteDir, "notes", "foo.html"))
+	if err != nil {
+		t.Fatalf("Failed to read notes/foo.html: %v", err)
+	}
+	for _, expected := range []string{
+		`<a href="../notes/deep/bar.html">deep/bar</a>`,
+		`<a href="../index.html">index</a>`,
+		`href="../style.css"`,
+	} {
+		if !strings.Contains(string(fooContent), expected) {
+			t.Errorf("Expected %s in notes/foo.html", expected)
+		}
+	}
+
+	barContent, err := os.ReadFile(filepath.Join(siteDir, "notes", "deep", "bar.html"))
+	if err != nil {
+		t.Fatalf("Failed to read notes/deep/bar.html: %v", err)
+	}
+	if !strings.Contains(string(barContent), `<a href="../../notes/foo.html">/notes/foo</a>`) {
+		t.Errorf("Root relative link in notes/deep/bar.html is incorrect")
+	}
+
+	listContent, err := os.ReadFile(filepath.Join(siteDir, "list.html"))
+	if err != nil {
+		t.Fatalf("Failed to read list.html: %v", err)
+	}
+	if !strings.Contains(string(listContent), `<h2 id="notes-deep">notes/deep</h2>`) {
+		t.Errorf("list.html does not group pages by folder")
+	}
+}
+
+func TestBacklinks(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\nLink to {{target}}.")
+	createDummyFile(t, filepath.Join(tmpDir, "other.md"), "# Other\n\nLink to {{target}} twice {{target}}.")
+	createDummyFile(t, filepath.Join(tmpDir, "target.md"), "# Target\n\nNo links here.")
+
+	cmd := exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, expectedSite, "target.html"))
+	if err != nil {
+		t.Fatalf("Failed to read target.html: %v", err)
+	}
+	if !strings.Contains(string(content), "Linked from") {
+		t.Errorf("Backlinks section missing from target.html")
+	}
+	for _, expected := range []string{`<a href="index.html">index</a>`, `<a href="other.html">other</a>`} {
+		if strings.Count(string(content), expected) != 1 {
+			t.Errorf("Expected exactly one backlink %s in target.html", expected)
+		}
+	}
+
+	content, err = os.ReadFile(filepath.Join(tmpDir, expectedSite, "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read index.html: %v", err)
+	}
+	if strings.Contains(string(content), "Linked from") {
+		t.Errorf("index.html should not have a backlinks section")
+	}
+
+	// the backlinks show the titles of the pages, and follow when they change
+	createDummyFile(t, filepath.Join(tmpDir, "other.md"), "---\ntitle: Renamed\n---\n# Other\n\nLink to {{target}} twice {{target}}.")
+	cmd = exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+	content, err = os.ReadFile(filepath.Join(tmpDir, expectedSite, "target.html"))
+	if err != nil || !strings.Contains(string(content), `<a href="other.html">Renamed</a>`) {
+		t.Errorf("Expected the backlink to use the new title of other.md")
+	}
+}
+
+func TestBrokenLinks(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\nLink to {{missing page}} and {{other}}.")
+	createDummyFile(t, filepath.Join(tmpDir, "other.md"), "# Other\n\nBack to {{index}}.")
+
+	// a normal build reports the broken link but succeeds
+	cmd := exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+	if !strings.Contains(string(output), "index.md -> missing page") {
+		t.Errorf("Expected broken link report, but got: %s", string(output))
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, expectedSite, "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read index.html: %v", err)
+	}
+	if !strings.Contains(string(content), `<a class="missing" href="missing-page.html">missing page</a>`) {
+		t.Errorf("Broken link was not marked as missing in index.html")
+	}
+	if !strings.Contains(string(content), `<a href="other.html">other</a>`) {
+		t.Errorf("Valid link was not converted in index.html")
+	}
+
+	// a strict build fails
+	cmd = exec.Command(mdwiBinaryAbsPath, "--strict")
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Errorf("mdwi --strict should fail with broken links\nOutput: %s", string(output))
+	}
+}
+
+func TestWatch(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\nLink to {{later}}.")
+
+	cmd := exec.Command(mdwiBinaryAbsPath, "--watch")
+	cmd.Dir = tmpDir
+	err := cmd.Start()
+	if err != nil {
+		t.Fatalf("Failed to start mdwi --watch: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	siteDir := filepath.Join(tmpDir, expectedSite)
+	indexHtml := filepath.Join(siteDir, "index.html")
+	laterHtml := filepath.Join(siteDir, "later.html")
+
+	// wait for the given file to satisfy the condition, or give up after a few seconds
+	waitFor := func(path string, cond func(string) bool) bool {
+		for i := 0; i < 50; i++ {
+			content, err := os.ReadFile(path)
+			if err == nil && cond(string(content)) {
+				return true
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		return false
+	}
+
+	if !waitFor(indexHtml, func(s string) bool { return strings.Contains(s, `class="missing"`) }) {
+		t.Fatalf("Initial build did not mark the missing page")
+	}
+
+	// adding the missing page renders it and fixes the link
+	createDummyFile(t, filepath.Join(tmpDir, "later.md"), "# Later\n\nAdded while watching.")
+	if !waitFor(laterHtml, func(s string) bool { return strings.Contains(s, "Added while watching") }) {
+		t.Errorf("later.html was not generated after later.md was created")
+	}
+	if !waitFor(indexHtml, func(s string) bool { return !strings.Contains(s, `class="missing"`) }) {
+		t.Errorf("index.html was not rebuilt after later.md was created")
+	}
+
+	// a new title shows up in the backlinks of the pages it links to
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "---\ntitle: Renamed\n---\n# Index\n\nLink to {{later}}.")
+	if !waitFor(laterHtml, func(s string) bool { return strings.Contains(s, `index.html">Renamed</a>`) }) {
+		t.Errorf("later.html was not rebuilt after the title of index.md changed")
+	}
+
+	// removing the page removes its output
+	os.Remove(filepath.Join(tmpDir, "later.md"))
+	if !waitFor(indexHtml, func(s string) bool { return strings.Contains(s, `class="missing"`) }) {
+		t.Errorf("index.html was not rebuilt after later.md was removed")
+	}
+	if _, err := os.Stat(laterHtml); !os.IsNotExist(err) {
+		t.Errorf("later.html was not removed after later.md was removed")
+	}
+}
+
+func TestServe(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\nServed page.")
+
+	// find a free port for the server
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+
+	cmd := exec.Command(mdwiBinaryAbsPath, "serve", port)
+	cmd.Dir = tmpDir
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("Failed to start mdwi serve: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	base := "http://localhost:" + port
+
+	// wait for the server to come up
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		resp, err = http.Get(base + "/")
+		if err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Server did not start: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if !strings.Contains(string(body), "Served page.") {
+		t.Errorf("Expected the index page, but got: %s", string(body))
+	}
+	if !strings.Contains(string(body), "EventSource") {
+		t.Errorf("Live reload script was not injected in serve mode")
+	}
+
+	// a change to a source file sends a reload event
+	events, err := http.Get(base + "/_mdwi/reload")
+	if err != nil {
+		t.Fatalf("Failed to connect to the reload stream: %v", err)
+	}
+	defer events.Body.Close()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\nChanged page.")
+
+	received := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(events.Body).ReadString('\n')
+		received <- line
+	}()
+
+	select {
+	case line := <-received:
+		if !strings.Contains(line, "reload") {
+			t.Errorf("Expected a reload event, but got: %s", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("No reload event received after changing a file")
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Welcome\n\nSome text.\n\n## Getting Started\n\nFind the needle here.")
+
+	cmd := exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	siteDir := filepath.Join(tmpDir, expectedSite)
+
+	data, err := os.ReadFile(filepath.Join(siteDir, "search.json"))
+	if err != nil {
+		t.Fatalf("Failed to read search.json: %v", err)
+	}
+
+	var index []struct {
+		Title    string `json:"title"`
+		URL      string `json:"url"`
+		Headings []struct {
+			Text string `json:"text"`
+			ID   string `json:"id"`
+		} `json:"headings"`
+		Body string `json:"body"`
+	}
+	err = json.Unmarshal(data, &index)
+	if err != nil {
+		t.Fatalf("Failed to parse search.json: %v", err)
+	}
+	if len(index) != 1 {
+		t.Fatalf("Expected 1 page in the search index, got %d", len(index))
+	}
+	if index[0].Title != "Welcome" || index[0].URL != "index.html" {
+		t.Errorf("Unexpected search entry: %+v", index[0])
+	}
+	if len(index[0].Headings) != 2 || index[0].Headings[1].ID != "getting-started" {
+		t.Errorf("Unexpected headings in search entry: %+v", index[0].Headings)
+	}
+	if !strings.Contains(index[0].Body, "Find the needle here.") {
+		t.Errorf("Body text missing from search entry: %s", index[0].Body)
+	}
+
+	for _, file := range []string{"search.js", "search_index.js"} {
+		if _, err := os.Stat(filepath.Join(siteDir, file)); os.IsNotExist(err) {
+			t.Errorf("Expected file %s was not created in _site", file)
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(siteDir, "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read index.html: %v", err)
+	}
+	if !strings.Contains(string(content), `id="search"`) || !strings.Contains(string(content), `src="search_index.js"`) {
+		t.Errorf("Search box was not injected in index.html")
+	}
+}
+
+func TestFrontMatter(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "---\ntitle: Home Page\n---\n# Index\n\nLink to {{ml}} and {{secret}}.")
+	createDummyFile(t, filepath.Join(tmpDir, "machine.md"), "+++\ntitle = \"Machine Learning\"\naliases = [\"ml\"]\ndate = 2024-05-06\n+++\n# ML\n\nSome notes.")
+	createDummyFile(t, filepath.Join(tmpDir, "secret.md"), "---\ndraft: true\n---\n# Secret\n\nNot ready yet.")
+	createDummyFile(t, filepath.Join(tmpDir, "steps.md"), "---\ntitle: \"Step 1] *setup* <b>x</b> {{y}}\"\n---\n# Steps")
+
+	cmd := exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	siteDir := filepath.Join(tmpDir, expectedSite)
+
+	indexContent, err := os.ReadFile(filepath.Join(siteDir, "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read index.html: %v", err)
+	}
+	if !strings.Contains(string(indexContent), "<title>Home Page</title>") {
+		t.Errorf("Title from front matter was not used in index.html")
+	}
+	if strings.Contains(string(indexContent), "title: Home Page") {
+		t.Errorf("Front matter was rendered as text in index.html")
+	}
+	if !strings.Contains(string(indexContent), `<a href="machine.html">ml</a>`) {
+		t.Errorf("Alias link was not resolved in index.html")
+	}
+
+	// drafts are not built
+	if _, err := os.Stat(filepath.Join(siteDir, "secret.html")); !os.IsNotExist(err) {
+		t.Errorf("Draft page secret.html should not be generated")
+	}
+
+	listContent, err := os.ReadFile(filepath.Join(siteDir, "list.html"))
+	if err != nil {
+		t.Fatalf("Failed to read list.html: %v", err)
+	}
+	if !strings.Contains(string(listContent), `<a href="machine.html">Machine Learning</a> <em>2024-05-06</em>`) {
+		t.Errorf("list.html does not use the front matter title and date")
+	}
+	if strings.Contains(string(listContent), "secret") {
+		t.Errorf("list.html should not list drafts")
+	}
+	if !strings.Contains(string(listContent), `<a href="steps.html">Step 1] *setup* &lt;b&gt;x&lt;/b&gt; {{y}}</a>`) {
+		t.Errorf("list.html does not show the title as it is: %s", string(listContent))
+	}
+
+	// invalid front matter fails the build with the file name
+	createDummyFile(t, filepath.Join(tmpDir, "broken.md"), "---\ntags: [unclosed\n---\n# Broken")
+	cmd = exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Errorf("mdwi should fail on invalid front matter\nOutput: %s", string(output))
+	}
+	if !strings.Contains(string(output), "broken.md") {
+		t.Errorf("Expected the file name in the error, but got: %s", string(output))
+	}
+}
+
+func TestTags(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "---\ntags: [golang, Web Dev]\n---\n# Index\n\nHome page.")
+	createDummyFile(t, filepath.Join(tmpDir, "notes.md"), "# Notes\n\nAbout #golang but not `#code`.")
+	createDummyFile(t, filepath.Join(tmpDir, "odd.md"), "---\ntags: [\"a]b *c* <i>\"]\n---\n# Odd")
+
+	cmd := exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	siteDir := filepath.Join(tmpDir, expectedSite)
+	for _, file := range []string{"tags.html", "tag-golang.html", "tag-web-dev.html"} {
+		if _, err := os.Stat(filepath.Join(siteDir, file)); os.IsNotExist(err) {
+			t.Errorf("Expected file %s was not created in _site", file)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(siteDir, "tag-code.html")); !os.IsNotExist(err) {
+		t.Errorf("Tags in code should be ignored")
+	}
+
+	tagsContent, err := os.ReadFile(filepath.Join(siteDir, "tags.html"))
+	if err != nil {
+		t.Fatalf("Failed to read tags.html: %v", err)
+	}
+	if !strings.Contains(string(tagsContent), `<a href="tag-golang.html">golang</a> (2)`) {
+		t.Errorf("tags.html does not list the golang tag with its count")
+	}
+	if !strings.Contains(string(tagsContent), `<a href="tag-a-b--c---i.html">a]b-*c*-&lt;i&gt;</a> (1)`) {
+		t.Errorf("tags.html does not show the tag as it is: %s", string(tagsContent))
+	}
+	oddContent, err := os.ReadFile(filepath.Join(siteDir, "tag-a-b--c---i.html"))
+	if err != nil || !strings.Contains(string(oddContent), `>Tag: a]b-*c*-&lt;i&gt;</h1>`) {
+		t.Errorf("The tag page does not show the tag as it is")
+	}
+
+	tagContent, err := os.ReadFile(filepath.Join(siteDir, "tag-golang.html"))
+	if err != nil {
+		t.Fatalf("Failed to read tag-golang.html: %v", err)
+	}
+	for _, expected := range []string{`<a href="index.html">index</a>`, `<a href="notes.html">notes</a>`} {
+		if !strings.Contains(string(tagContent), expected) {
+			t.Errorf("Expected %s in tag-golang.html", expected)
+		}
+	}
+
+	notesContent, err := os.ReadFile(filepath.Join(siteDir, "notes.html"))
+	if err != nil {
+		t.Fatalf("Failed to read notes.html: %v", err)
+	}
+	if !strings.Contains(string(notesContent), `<a class="tag" href="tag-golang.html">#golang</a>`) {
+		t.Errorf("Inline tag was not linked in notes.html")
+	}
+	if !strings.Contains(string(notesContent), `<a href="tags.html">`) {
+		t.Errorf("Tags link missing from the sidebar in notes.html")
+	}
+}
+
+func TestLinkLabelsAndHeadings(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\n{{guide|Read the guide}} {{guide#Getting Started}} {{guide#Nowhere|bad}} {{#Index}}")
+	createDummyFile(t, filepath.Join(tmpDir, "guide.md"), "# Guide\n\n## Getting Started\n\nHello.")
+
+	cmd := exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+	if !strings.Contains(string(output), "guide#Nowhere (missing heading)") {
+		t.Errorf("Expected a warning about the missing heading, but got: %s", string(output))
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, expectedSite, "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read index.html: %v", err)
+	}
+	for _, expected := range []string{
+		`<a href="guide.html">Read the guide</a>`,
+		`<a href="guide.html#getting-started">guide#Getting Started</a>`,
+		`<a href="guide.html#nowhere">bad</a>`,
+		`<a href="#index">#Index</a>`,
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected %s in index.html", expected)
+		}
+	}
+
+	guideContent, err := os.ReadFile(filepath.Join(tmpDir, expectedSite, "guide.html"))
+	if err != nil {
+		t.Fatalf("Failed to read guide.html: %v", err)
+	}
+	if !strings.Contains(string(guideContent), `id="getting-started"`) {
+		t.Errorf("Heading ID in guide.html does not match the link")
+	}
+}
+
+func TestUnicodeLinks(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\n{{Café-notes}} {{2024.Q3 plan}} {{tom's page}} {{東京}} {{café-NOTES|upper}} {{ .Title }}")
+	createDummyFile(t, filepath.Join(tmpDir, "Café-notes.md"), "# Café")
+	createDummyFile(t, filepath.Join(tmpDir, "2024.Q3 plan.md"), "# Plan")
+	createDummyFile(t, filepath.Join(tmpDir, "tom's page.md"), "# Tom")
+	createDummyFile(t, filepath.Join(tmpDir, "東京.md"), "# Tokyo")
+
+	cmd := exec.Command(mdwiBinaryAbsPath, "--strict")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	siteDir := filepath.Join(tmpDir, expectedSite)
+	for _, file := range []string{"Café-notes.html", "2024.Q3-plan.html", "tom-s-page.html", "東京.html"} {
+		if _, err := os.Stat(filepath.Join(siteDir, file)); os.IsNotExist(err) {
+			t.Errorf("Expected file %s was not created in _site", file)
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(siteDir, "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read index.html: %v", err)
+	}
+	for _, expected := range []string{
+		`<a href="Caf%C3%A9-notes.html">Café-notes</a>`,
+		`<a href="2024.Q3-plan.html">2024.Q3 plan</a>`,
+		`<a href="tom-s-page.html">tom&#39;s page</a>`,
+		`<a href="%E6%9D%B1%E4%BA%AC.html">東京</a>`,
+		`<a href="Caf%C3%A9-notes.html">upper</a>`,
+		`{{ .Title }}`,
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected %s in index.html", expected)
+		}
+	}
+
+	listContent, err := os.ReadFile(filepath.Join(siteDir, "list.html"))
+	if err != nil {
+		t.Fatalf("Failed to read list.html: %v", err)
+	}
+	if !strings.Contains(string(listContent), `href="2024.Q3-plan.html"`) {
+		t.Errorf("list.html does not use the same file names as the links")
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\n{{!snippets/disclaimer}}\n\n{{!contacts#Phones}}\n\n{{!loop}}\n")
+	err := os.Mkdir(filepath.Join(tmpDir, "snippets"), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create subfolder: %v", err)
+	}
+	createDummyFile(t, filepath.Join(tmpDir, "snippets", "disclaimer.md"), "---\ntitle: Disclaimer\n---\nNo warranty. See {{contacts}}.\n")
+	createDummyFile(t, filepath.Join(tmpDir, "contacts.md"), "# Contacts\n\n## Phones\n\n555-1234\n\n## Emails\n\nnobody@example.com\n")
+	createDummyFile(t, filepath.Join(tmpDir, "loop.md"), "# Loop\n\n{{!loop}}\n")
+
+	cmd := exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+	if !strings.Contains(string(output), "embed cycle") {
+		t.Errorf("Expected the embed cycle to be reported, got: %s", string(output))
+	}
+
+	// the pages taken from the cache report their embeds too
+	cmd = exec.Command(mdwiBinaryAbsPath, "--verbose")
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+	if !strings.Contains(string(output), "Cache hit: loop.md") || !strings.Contains(string(output), "Warning: loop embeds loop: embed cycle loop -> loop") {
+		t.Errorf("Expected the embed cycle to be reported by a cached build, got: %s", string(output))
+	}
+
+	// an embedded section that doesn't exist is a broken link
+	createDummyFile(t, filepath.Join(tmpDir, "faq.md"), "# FAQ\n\n{{!contacts#Nope}}\n")
+	cmd = exec.Command(mdwiBinaryAbsPath, "check")
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "contacts#Nope") {
+		t.Errorf("Expected the missing section to be a broken link, got: %s", string(output))
+	}
+	os.Remove(filepath.Join(tmpDir, "faq.md"))
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, expectedSite, "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read index.html: %v", err)
+	}
+	for _, expected := range []string{
+		`<div class="embed"><p>No warranty. See <a href="contacts.html">contacts</a>.</p>`,
+		`<h2 id="phones">Phones</h2>`,
+		`555-1234`,
+		`<div class="embed-error">`,
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected %s in index.html", expected)
+		}
+	}
+	for _, unexpected := range []string{"title: Disclaimer", "nobody@example.com", "mdwiembed"} {
+		if strings.Contains(string(content), unexpected) {
+			t.Errorf("Did not expect %s in index.html", unexpected)
+		}
+	}
+
+	// the standalone file includes the embedded pages as well
+	cmd = exec.Command(mdwiBinaryAbsPath, "-s", "index.md")
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi standalone command failed: %v\nOutput: %s", err, string(output))
+	}
+	content, err = os.ReadFile(filepath.Join(tmpDir, expectedSite, "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read index.html: %v", err)
+	}
+	if !strings.Contains(string(content), "No warranty.") || !strings.Contains(string(content), "555-1234") {
+		t.Errorf("Standalone file does not contain the embedded pages")
+	}
+}
+
+func TestStandaloneFollow(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	err := os.Mkdir(filepath.Join(tmpDir, "notes"), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create subfolder: %v", err)
+	}
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\nSee {{notes/foo}} and {{notes/foo#Details|the details}}.")
+	createDummyFile(t, filepath.Join(tmpDir, "notes", "foo.md"), "# Foo\n\n## Details\n\n![pic](pic.png) Back to {{/index}}, on to {{bar}}.")
+	createDummyFile(t, filepath.Join(tmpDir, "notes", "bar.md"), "# Bar\n\nThe end.")
+	createDummyFile(t, filepath.Join(tmpDir, "notes", "pic.png"), "png")
+	createDummyFile(t, filepath.Join(tmpDir, "unrelated.md"), "# Unrelated\n\nNot linked.")
+
+	cmd := exec.Command(mdwiBinaryAbsPath, "--standalone", "--follow", "index.md")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, expectedSite, "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read index.html: %v", err)
+	}
+	for _, expected := range []string{
+		`<section id="index">`,
+		`<section id="notes-foo">`,
+		`<section id="notes-bar">`,
+		`<a href="#notes-foo">notes/foo</a>`,
+		`<a href="#notes-foo--details">the details</a>`,
+		`<h2 id="notes-foo--details">Details</h2>`,
+		`<a href="#index">/index</a>`,
+		`<a href="#notes-bar">bar</a>`,
+		`src="data:image/png;base64,`,
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected %s in index.html", expected)
+		}
+	}
+	if strings.Contains(string(content), "Not linked.") {
+		t.Errorf("Pages that are not linked should not be included")
+	}
+}
+
+func TestSrcOutDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	err := os.MkdirAll(filepath.Join(tmpDir, "wikis", "a", "notes"), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create subdirectories: %v", err)
+	}
+	createDummyFile(t, filepath.Join(tmpDir, "wikis", "a", "index.md"), "# Index\n\nLink to {{notes/foo}}.")
+	createDummyFile(t, filepath.Join(tmpDir, "wikis", "a", "notes", "foo.md"), "# Foo\n\n![pic](pic.png)")
+	createDummyFile(t, filepath.Join(tmpDir, "wikis", "a", "notes", "pic.png"), "png")
+
+	cmd := exec.Command(mdwiBinaryAbsPath, "--src", filepath.Join("wikis", "a"), "--out", filepath.Join("public", "a"))
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	for _, file := range []string{"index.html", "list.html", "style.css", "search.json", filepath.Join("notes", "foo.html"), filepath.Join("notes", "pic.png")} {
+		if _, err := os.Stat(filepath.Join(tmpDir, "public", "a", file)); os.IsNotExist(err) {
+			t.Errorf("Expected file %s was not created in public/a", file)
+		}
+	}
+	for _, dir := range []string{"_site", "_tmp", filepath.Join("wikis", "a", "_site"), filepath.Join("public", "a", "_tmp")} {
+		if _, err := os.Stat(filepath.Join(tmpDir, dir)); !os.IsNotExist(err) {
+			t.Errorf("Did not expect %s to exist", dir)
+		}
+	}
+
+	// an output directory containing the sources would delete them
+	cmd = exec.Command(mdwiBinaryAbsPath, "--src", filepath.Join("wikis", "a"), "--out", "wikis")
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Errorf("Expected an error for an output directory containing the sources, got: %s", string(output))
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "wikis", "a", "index.md")); os.IsNotExist(err) {
+		t.Fatalf("The source files were removed")
+	}
+
+	// standalone files can be written anywhere with -o
+	cmd = exec.Command(mdwiBinaryAbsPath, "--src", filepath.Join("wikis", "a"), "-s", filepath.Join("wikis", "a", "index.md"), "-o", filepath.Join("dist", "a.html"))
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi -s -o command failed: %v\nOutput: %s", err, string(output))
+	}
+	content, err := os.ReadFile(filepath.Join(tmpDir, "dist", "a.html"))
+	if err != nil {
+		t.Fatalf("Failed to read standalone file: %v", err)
+	}
+	if !strings.Contains(string(content), `<a href="notes/foo.html">notes/foo</a>`) {
+		t.Errorf("Wiki link was not converted in the standalone file")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "public", "a", "index.html")); os.IsNotExist(err) {
+		t.Errorf("Writing a standalone file with -o should not touch the site")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	err := os.Mkdir(filepath.Join(tmpDir, "drafts"), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create subfolder: %v", err)
+	}
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Home\n\nTerm\n: Definition\n")
+	createDummyFile(t, filepath.Join(tmpDir, "drafts", "wip.md"), "# Work in progress")
+	createDummyFile(t, filepath.Join(tmpDir, "custom.css"), "body { color: red; }")
+	createDummyFile(t, filepath.Join(tmpDir, "mdwi.toml"), `
+title = "Team Wiki"
+footer = "<p>Maintained by the team</p>"
+stylesheet = "custom.css"
+extensions = ["definition-lists"]
+exclude = ["drafts"]
+output = "public"
+
+[[nav]]
+title = "Start"
+url = "index.html"
+`)
+
+	cmd := exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	siteDir := filepath.Join(tmpDir, "public")
+	content, err := os.ReadFile(filepath.Join(siteDir, "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read index.html: %v", err)
+	}
+	for _, expected := range []string{
+		`<title>index - Team Wiki</title>`,
+		`<h3 class="site-title"><a href="index.html">Team Wiki</a></h3>`,
+		`<li><a href="index.html">Start</a></li>`,
+		`<p>Maintained by the team</p>`,
+		`<dl>`,
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected %s in index.html", expected)
+		}
+	}
+	if strings.Contains(string(content), "📁 List") {
+		t.Errorf("The nav links from the config should replace the default links")
+	}
+
+	stylesheet, err := os.ReadFile(filepath.Join(siteDir, "style.css"))
+	if err != nil || string(stylesheet) != "body { color: red; }" {
+		t.Errorf("The stylesheet from the config was not used: %s", string(stylesheet))
+	}
+	if _, err := os.Stat(filepath.Join(siteDir, "drafts", "wip.html")); !os.IsNotExist(err) {
+		t.Errorf("Excluded files should not be built")
+	}
+
+	// the command line options override the config file
+	cmd = exec.Command(mdwiBinaryAbsPath, "--out", "other")
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi --out command failed: %v\nOutput: %s", err, string(output))
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "other", "index.html")); os.IsNotExist(err) {
+		t.Errorf("--out should override the output directory of the config file")
+	}
+
+	// mistakes in the config file are reported
+	createDummyFile(t, filepath.Join(tmpDir, "mdwi.toml"), "titel = \"Typo\"\n")
+	cmd = exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Errorf("Expected an error for an unknown option")
+	}
+	if !strings.Contains(string(output), `unknown option "titel"`) {
+		t.Errorf("Expected the unknown option to be reported, got: %s", string(output))
+	}
+}
+
+func TestSubcommands(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\nLink to {{another}}.")
+
+	run := func(args ...string) (string, int) {
+		cmd := exec.Command(mdwiBinaryAbsPath, args...)
+		cmd.Dir = tmpDir
+		output, err := cmd.CombinedOutput()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return string(output), exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatalf("mdwi %v failed to run: %v", args, err)
+		}
+		return string(output), 0
+	}
+
+	// misuse exits with code 2
+	for _, args := range [][]string{{"bogus"}, {"build", "--bogus"}, {"build", "extra"}, {"standalone"}, {"new"}} {
+		if output, code := run(args...); code != 2 {
+			t.Errorf("Expected exit code 2 for mdwi %v, got %d: %s", args, code, output)
+		}
+	}
+
+	// new creates a page with front matter, but doesn't overwrite it
+	if output, code := run("new", "another", "--title", "Another Page"); code != 0 {
+		t.Fatalf("mdwi new failed: %s", output)
+	}
+	content, err := os.ReadFile(filepath.Join(tmpDir, "another.md"))
+	if err != nil {
+		t.Fatalf("Failed to read another.md: %v", err)
+	}
+	if !strings.HasPrefix(string(content), "---\ntitle: \"Another Page\"\n") {
+		t.Errorf("Unexpected content of the new page: %s", string(content))
+	}
+	if _, code := run("new", "another"); code != 1 {
+		t.Errorf("Expected mdwi new to fail for an existing page")
+	}
+	for _, name := range []string{filepath.Join("..", "escaped"), filepath.Join(tmpDir, "absolute")} {
+		if output, code := run("new", name); code != 1 || !strings.Contains(output, "page name must be a path inside the wiki") {
+			t.Errorf("Expected mdwi new to refuse %s, got: %s", name, output)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(tmpDir), "escaped.md")); !os.IsNotExist(err) {
+		t.Errorf("escaped.md should not be created outside the wiki")
+	}
+
+	// check reports broken links through the exit code, without building the wiki
+	if output, code := run("check"); code != 0 {
+		t.Errorf("Expected mdwi check to pass: %s", output)
+	}
+	createDummyFile(t, filepath.Join(tmpDir, "broken.md"), "{{nowhere}}")
+	if _, code := run("check"); code != 1 {
+		t.Errorf("Expected mdwi check to fail for a broken link")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, expectedSite)); !os.IsNotExist(err) {
+		t.Errorf("mdwi check should not build the wiki")
+	}
+
+	// options can be combined, and given before the command
+	if output, code := run("--out", "public", "build", "--src", "."); code != 0 {
+		t.Fatalf("mdwi build failed: %s", output)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "public", "another.html")); os.IsNotExist(err) {
+		t.Errorf("Expected another.html in the output directory")
+	}
+	if output, code := run("standalone", "index.md", "-o", "single.html"); code != 0 {
+		t.Fatalf("mdwi standalone failed: %s", output)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "single.html")); os.IsNotExist(err) {
+		t.Errorf("Expected the standalone file single.html")
+	}
+}
+
+func TestLayout(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// page content that used to confuse the regex based injection
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\nSee {{other}}.\n\n```\n<nav>\n</head>\n<footer>\n```\n")
+	createDummyFile(t, filepath.Join(tmpDir, "other.md"), "No headings, but a link back to {{index}}.")
+
+	cmd := exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "_site", "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read index.html: %v", err)
+	}
+	if strings.Count(string(content), "<main>") != 1 || strings.Count(string(content), "<footer>") != 1 {
+		t.Errorf("Page content should not be mistaken for the page layout")
+	}
+	if !strings.Contains(string(content), "&lt;/head&gt;") {
+		t.Errorf("Code block was not escaped in index.html")
+	}
+
+	// pages without headings still get the sidebar
+	content, err = os.ReadFile(filepath.Join(tmpDir, "_site", "other.html"))
+	if err != nil {
+		t.Fatalf("Failed to read other.html: %v", err)
+	}
+	if !strings.Contains(string(content), `<div class="search">`) || !strings.Contains(string(content), "<main>") {
+		t.Errorf("Sidebar or main missing from a page without headings")
+	}
+
+	// a _layout.html in the wiki root replaces the default layout
+	createDummyFile(t, filepath.Join(tmpDir, "_layout.html"), `<html><head><title>{{.Title}} | Acme</title>{{.Head}}</head><body>
+<header>{{range .Nav}}<a href="{{.URL}}">{{.Title}}</a>{{end}}</header>
+<aside>{{range .Backlinks}}<a class="back" href="{{.URL}}">{{.Title}}</a>{{end}}</aside>
+<article>{{.Body}}</article></body></html>`)
+
+	cmd = exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	content, err = os.ReadFile(filepath.Join(tmpDir, "_site", "other.html"))
+	if err != nil {
+		t.Fatalf("Failed to read other.html: %v", err)
+	}
+	for _, expected := range []string{
+		`<title>other | Acme</title>`,
+		`<link rel="stylesheet" href="style.css">`,
+		`<a href="list.html">📁 List</a>`,
+		`<a class="back" href="index.html">index</a>`,
+		`<article><p>No headings, but a link back to <a href="index.html">index</a>.</p>`,
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected %s in other.html", expected)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "_site", "_layout.html")); !os.IsNotExist(err) {
+		t.Errorf("The layout should not be copied to the site")
+	}
+
+	// template errors are reported
+	createDummyFile(t, filepath.Join(tmpDir, "_layout.html"), "{{.Body")
+	cmd = exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "_layout.html") {
+		t.Errorf("Expected an error for a broken layout, got: %s", string(output))
+	}
+}
+
+func TestThemes(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index")
+
+	cmd := exec.Command(mdwiBinaryAbsPath, "--theme", "dark")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "_site", "style.css"))
+	if err != nil {
+		t.Fatalf("Failed to read style.css: %v", err)
+	}
+	if !strings.Contains(string(content), "color-scheme: dark;") || !strings.Contains(string(content), "background: var(--background)") {
+		t.Errorf("Expected the dark theme in style.css")
+	}
+
+	// the theme and the custom css from the config file
+	createDummyFile(t, filepath.Join(tmpDir, "mdwi.toml"), "theme = \"auto\"\ncustom_css = \"extra.css\"\n")
+	createDummyFile(t, filepath.Join(tmpDir, "extra.css"), ":root { --link: #c00; }")
+
+	cmd = exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	content, err = os.ReadFile(filepath.Join(tmpDir, "_site", "style.css"))
+	if err != nil {
+		t.Fatalf("Failed to read style.css: %v", err)
+	}
+	if !strings.Contains(string(content), "@media (prefers-color-scheme: dark)") {
+		t.Errorf("Expected the auto theme to follow the color scheme preference")
+	}
+	if !strings.HasSuffix(string(content), ":root { --link: #c00; }") {
+		t.Errorf("Expected the custom css at the end of style.css")
+	}
+
+	// standalone files inline the custom css too
+	cmd = exec.Command(mdwiBinaryAbsPath, "standalone", "index.md", "-o", "page.html", "--theme", "sepia")
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	content, err = os.ReadFile(filepath.Join(tmpDir, "page.html"))
+	if err != nil {
+		t.Fatalf("Failed to read page.html: %v", err)
+	}
+	if !strings.Contains(string(content), "--background: #f4ecd8;") || !strings.Contains(string(content), ":root { --link: #c00; }") {
+		t.Errorf("Expected the sepia theme and the custom css in page.html")
+	}
+
+	// unknown themes are errors
+	cmd = exec.Command(mdwiBinaryAbsPath, "--theme", "neon")
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(output), `unknown theme "neon"`) {
+		t.Errorf("Expected an error for an unknown theme, got: %s", string(output))
+	}
+}
+
+func TestStaticFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\nSee {{other}}.")
+	createDummyFile(t, filepath.Join(tmpDir, "other.md"), "# Other")
+	os.MkdirAll(filepath.Join(tmpDir, "static", "js"), 0755)
+	createDummyFile(t, filepath.Join(tmpDir, "static", "robots.txt"), "User-agent: *")
+	createDummyFile(t, filepath.Join(tmpDir, "static", "style.css"), "body { color: red; }")
+	createDummyFile(t, filepath.Join(tmpDir, "static", "js", "analytics.js"), "// analytics")
+	createDummyFile(t, filepath.Join(tmpDir, "static", "notes.md"), "# Notes")
+
+	// a file put into the output directory by hand
+	os.MkdirAll(filepath.Join(tmpDir, "_site"), 0755)
+	createDummyFile(t, filepath.Join(tmpDir, "_site", "mine.txt"), "hand made")
+
+	cmd := exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	for file, expected := range map[string]string{
+		"robots.txt":      "User-agent: *",
+		"style.css":       "body { color: red; }",
+		"js/analytics.js": "// analytics",
+		"notes.md":        "# Notes",
+		"mine.txt":        "hand made",
+	} {
+		content, err := os.ReadFile(filepath.Join(tmpDir, "_site", filepath.FromSlash(file)))
+		if err != nil || string(content) != expected {
+			t.Errorf("Expected %s in _site/%s, got %q (%v)", expected, file, string(content), err)
+		}
+	}
+	for _, file := range []string{"notes.html", filepath.Join("static", "robots.txt")} {
+		if _, err := os.Stat(filepath.Join(tmpDir, "_site", file)); !os.IsNotExist(err) {
+			t.Errorf("%s should not be in _site", file)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "_site", ".mdwi-manifest.json")); err != nil {
+		t.Errorf("The build manifest was not written: %v", err)
+	}
+
+	// files that are no longer generated are removed, the others are kept
+	os.Remove(filepath.Join(tmpDir, "other.md"))
+	os.RemoveAll(filepath.Join(tmpDir, "static", "js"))
+
+	cmd = exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	for _, file := range []string{"other.html", "js"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, "_site", file)); !os.IsNotExist(err) {
+			t.Errorf("%s should have been removed from _site", file)
+		}
+	}
+	for _, file := range []string{"index.html", "robots.txt", "mine.txt"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, "_site", file)); err != nil {
+			t.Errorf("%s should still be in _site: %v", file, err)
+		}
+	}
+
+	// a clean build removes all the generated files first, but not the others
+	cmd = exec.Command(mdwiBinaryAbsPath, "build", "--clean")
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+	if !strings.Contains(string(output), "Removed "+filepath.Join("_site", "index.html")) {
+		t.Errorf("Expected the clean build to remove index.html, got: %s", string(output))
+	}
+	for _, file := range []string{"index.html", "robots.txt", "mine.txt"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, "_site", file)); err != nil {
+			t.Errorf("%s should be in _site after a clean build: %v", file, err)
+		}
+	}
+}
+
+func TestAssets(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\n![photo](photo.JPEG)\n\n[report](docs/report.pdf) and [notes](notes.txt) and [layout](_layout.html) and [web](https://example.com/a.zip)\n\n![underscore](_img/a.png) and ![hidden](.hidden.png)")
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+	os.MkdirAll(filepath.Join(tmpDir, "_img"), 0755)
+	createDummyFile(t, filepath.Join(tmpDir, "_img", "a.png"), "png")
+	createDummyFile(t, filepath.Join(tmpDir, ".hidden.png"), "png")
+	createDummyFile(t, filepath.Join(tmpDir, "photo.JPEG"), "jpeg")
+	createDummyFile(t, filepath.Join(tmpDir, "docs", "report.pdf"), "pdf")
+	createDummyFile(t, filepath.Join(tmpDir, "notes.txt"), "txt")
+	createDummyFile(t, filepath.Join(tmpDir, "movie.MP4"), "mp4")
+	createDummyFile(t, filepath.Join(tmpDir, "other.txt"), "txt")
+	createDummyFile(t, filepath.Join(tmpDir, "_layout.html"), "{{.Body}}")
+
+	cmd := exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	// linked files of any type, and unlinked files with an asset extension
+	for _, file := range []string{"photo.JPEG", filepath.Join("docs", "report.pdf"), "notes.txt", "movie.MP4", filepath.Join("_img", "a.png")} {
+		if _, err := os.Stat(filepath.Join(tmpDir, "_site", file)); err != nil {
+			t.Errorf("%s was not copied to _site: %v", file, err)
+		}
+	}
+	for _, file := range []string{"other.txt", "_layout.html", ".hidden.png"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, "_site", file)); !os.IsNotExist(err) {
+			t.Errorf("%s should not be copied to _site", file)
+		}
+	}
+	if !strings.Contains(string(output), "Found 1 unused asset(s):\n  movie.MP4") {
+		t.Errorf("Expected movie.MP4 to be reported as unused, got: %s", string(output))
+	}
+	if !strings.Contains(string(output), "Warning: index.md links to .hidden.png, which is not copied to the site") {
+		t.Errorf("Expected a warning for the hidden file, got: %s", string(output))
+	}
+
+	// the config file replaces the asset extensions
+	createDummyFile(t, filepath.Join(tmpDir, "mdwi.toml"), "assets = [\"txt\"]\n")
+
+	cmd = exec.Command(mdwiBinaryAbsPath, "--clean")
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "_site", "other.txt")); err != nil {
+		t.Errorf("other.txt was not copied with the txt extension in the config: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "_site", "movie.MP4")); !os.IsNotExist(err) {
+		t.Errorf("movie.MP4 should not be copied without the mp4 extension in the config")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "_site", "photo.JPEG")); err != nil {
+		t.Errorf("Linked files should be copied whatever their extension: %v", err)
+	}
+}
+
+func TestParallelBuild(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	for i := 0; i < 40; i++ {
+		next := fmt.Sprintf("page%d", (i+1)%40)
+		createDummyFile(t, filepath.Join(tmpDir, fmt.Sprintf("page%d.md", i)), fmt.Sprintf("# Page %d\n\nNext is {{%s}}, missing is {{nowhere%d}}.\n\n{{!%s}}", i, next, i, next))
+	}
+
+	// the console output and the site are the same whatever the number of jobs
+	var outputs []string
+	for _, jobs := range []string{"1", "8"} {
+		cmd := exec.Command(mdwiBinaryAbsPath, "-j", jobs, "--out", "site"+jobs)
+		cmd.Dir = tmpDir
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+		}
+		outputs = append(outputs, strings.ReplaceAll(string(output), "site"+jobs, "site"))
+	}
+	if outputs[0] != outputs[1] {
+		t.Errorf("Expected the same output with -j 1 and -j 8, got:\n%s\nand:\n%s", outputs[0], outputs[1])
+	}
+	if !strings.Contains(outputs[0], "Warning: page8 embeds page9:") {
+		t.Errorf("Expected the embed warnings in the output")
+	}
+
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("page%d.html", i)
+		one, err := os.ReadFile(filepath.Join(tmpDir, "site1", name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		eight, err := os.ReadFile(filepath.Join(tmpDir, "site8", name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if string(one) != string(eight) {
+			t.Errorf("%s differs between -j 1 and -j 8", name)
+		}
+	}
+
+	// every failing page is reported, in the order of the files
+	createDummyFile(t, filepath.Join(tmpDir, "_layout.html"), `{{if or (eq .Name "page7") (eq .Name "page31")}}{{.Missing}}{{end}}{{.Body}}`)
+
+	cmd := exec.Command(mdwiBinaryAbsPath, "-j", "8", "--out", "site8")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("Expected the build to fail, got: %s", string(output))
+	}
+	first := strings.Index(string(output), "\n  page31.md:")
+	second := strings.Index(string(output), "\n  page7.md:")
+	if first == -1 || second < first {
+		t.Errorf("Expected the errors of page31.md and page7.md in order, got: %s", string(output))
+	}
+}
+
+func TestBuildCache(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\n{{!snippet}}")
+	createDummyFile(t, filepath.Join(tmpDir, "snippet.md"), "Snippet text")
+	createDummyFile(t, filepath.Join(tmpDir, "other.md"), "# Other\n\nSee {{gone}}.")
+	createDummyFile(t, filepath.Join(tmpDir, "gone.md"), "# Gone")
+	createDummyFile(t, filepath.Join(tmpDir, "alone.md"), "# Alone")
+
+	build := func() string {
+		cmd := exec.Command(mdwiBinaryAbsPath, "--verbose")
+		cmd.Dir = tmpDir
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+		}
+		return string(output)
+	}
+
+	output := build()
+	if !strings.Contains(output, "Cache miss: index.md (not cached)") {
+		t.Errorf("Expected every page to be rendered by the first build, got: %s", output)
+	}
+
+	// nothing changed
+	output = build()
+	for _, file := range []string{"index.md", "snippet.md", "other.md", "gone.md", "alone.md"} {
+		if !strings.Contains(output, "Cache hit: "+file) {
+			t.Errorf("Expected a cache hit for %s, got: %s", file, output)
+		}
+	}
+	if !strings.Contains(output, "Reused 5 unchanged page(s) from the cache") || strings.Contains(output, "Converted index.md") {
+		t.Errorf("Expected no pages to be rendered, got: %s", output)
+	}
+
+	// an embedded page changes, and a linked page is removed
+	createDummyFile(t, filepath.Join(tmpDir, "snippet.md"), "New snippet text")
+	os.Remove(filepath.Join(tmpDir, "gone.md"))
+
+	output = build()
+	for _, expected := range []string{
+		"Cache miss: index.md (changed)",
+		"Cache miss: snippet.md (changed)",
+		"Cache miss: other.md (changed)",
+		"Cache hit: alone.md",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %s, got: %s", expected, output)
+		}
+	}
+	content, err := os.ReadFile(filepath.Join(tmpDir, "_site", "index.html"))
+	if err != nil || !strings.Contains(string(content), "New snippet text") {
+		t.Errorf("index.html was not rendered with the new embedded text")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "_site", "gone.html")); !os.IsNotExist(err) {
+		t.Errorf("gone.html should have been removed with its page")
+	}
+
+	// the layout is an input of every page
+	createDummyFile(t, filepath.Join(tmpDir, "_layout.html"), "<main>{{.Body}}</main>")
+	output = build()
+	if strings.Contains(output, "Cache hit") {
+		t.Errorf("Expected every page to be rendered after the layout changed, got: %s", output)
+	}
+
+	// a deleted output is rendered again
+	os.Remove(filepath.Join(tmpDir, "_site", "alone.html"))
+	output = build()
+	if !strings.Contains(output, "Cache miss: alone.md (output missing)") {
+		t.Errorf("Expected alone.md to be rendered again, got: %s", output)
+	}
+
+	// so is an output replaced by another file, e.g. a standalone page
+	cmd := exec.Command(mdwiBinaryAbsPath, "standalone", "alone.md")
+	cmd.Dir = tmpDir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+	output = build()
+	if !strings.Contains(output, "Cache miss: index.md (output changed)") {
+		t.Errorf("Expected index.md to be rendered again, got: %s", output)
+	}
+	content, err = os.ReadFile(filepath.Join(tmpDir, "_site", "index.html"))
+	if err != nil || !strings.Contains(string(content), "New snippet text") {
+		t.Errorf("index.html should be the index page again")
+	}
+}
+
+func TestFailedPages(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index\n\nSee {{first}} and {{second}}.")
+	createDummyFile(t, filepath.Join(tmpDir, "first.md"), "# First")
+	createDummyFile(t, filepath.Join(tmpDir, "second.md"), "# Second")
+
+	cmd := exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	// both broken pages are reported, and the site is left as it was
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# New Index\n\nSee {{first}} and {{second}}.")
+	createDummyFile(t, filepath.Join(tmpDir, "first.md"), "---\ntitle: [unclosed\n---\n# First")
+	createDummyFile(t, filepath.Join(tmpDir, "second.md"), "---\ntags: [unclosed\n---\n# Second")
+
+	cmd = exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("Expected the build to fail, got: %s", string(output))
+	}
+	if !strings.Contains(string(output), "Error: 2 file(s) failed to build:\n  first.md: invalid front matter") || !strings.Contains(string(output), "\n  second.md: invalid front matter") {
+		t.Errorf("Expected both failing pages in the report, got: %s", string(output))
+	}
+	content, err := os.ReadFile(filepath.Join(tmpDir, "_site", "index.html"))
+	if err != nil || strings.Contains(string(content), "New Index") {
+		t.Errorf("The site should not change when the build fails")
+	}
+	entries, _ := os.ReadDir(tmpDir)
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), "staging") {
+			t.Errorf("The staging directory %s was left behind", entry.Name())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "_site", "_tmp")); !os.IsNotExist(err) {
+		t.Errorf("_tmp was left behind")
+	}
+
+	// --keep-going writes the other pages, keeping the previous version of the failed ones
+	cmd = exec.Command(mdwiBinaryAbsPath, "--keep-going")
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "Error: 2 file(s) failed to build:") {
+		t.Errorf("Expected the failed pages to be reported with --keep-going, got: %s", string(output))
+	}
+	content, err = os.ReadFile(filepath.Join(tmpDir, "_site", "index.html"))
+	if err != nil || !strings.Contains(string(content), "New Index") {
+		t.Errorf("index.html should be written with --keep-going")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "_site", "first.html")); err != nil {
+		t.Errorf("The previous version of first.html should be kept: %v", err)
+	}
+
+	// the failed pages are still part of the wiki, so the links to them work
+	if strings.Contains(string(content), `class="missing"`) || strings.Contains(string(output), "broken wiki link") {
+		t.Errorf("The links to the failed pages should not be broken, got: %s", string(output))
+	}
+	content, err = os.ReadFile(filepath.Join(tmpDir, "_site", "list.html"))
+	if err != nil || !strings.Contains(string(content), `<a href="first.html">`) {
+		t.Errorf("list.html should still list first.html")
+	}
+	cmd = exec.Command(mdwiBinaryAbsPath, "--keep-going", "--strict")
+	cmd.Dir = tmpDir
+	output, _ = cmd.CombinedOutput()
+	if strings.Contains(string(output), "broken") {
+		t.Errorf("--strict should not report the failed pages as broken links, got: %s", string(output))
+	}
+
+	// files that can't be copied are reported the same way, here because
+	// folders are in the way
+	copyDir := t.TempDir()
+	createDummyFile(t, filepath.Join(copyDir, "index.md"), "# Index\n\n![pic](pic.png)")
+	createDummyFile(t, filepath.Join(copyDir, "pic.png"), "png")
+	for _, dir := range []string{"static", filepath.Join("_site", "pic.png"), filepath.Join("_site", "robots.txt")} {
+		if err := os.MkdirAll(filepath.Join(copyDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createDummyFile(t, filepath.Join(copyDir, "static", "robots.txt"), "User-agent: *")
+	createDummyFile(t, filepath.Join(copyDir, "_site", "pic.png", "mine.txt"), "mine")
+
+	cmd = exec.Command(mdwiBinaryAbsPath, "--keep-going")
+	cmd.Dir = copyDir
+	output, err = cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "Error: 2 file(s) failed to build:\n  pic.png: asset copy:") || !strings.Contains(string(output), "\n  "+filepath.Join("static", "robots.txt")+": static copy:") {
+		t.Errorf("Expected both failed copies in the report, got: %s", string(output))
+	}
+	if _, err := os.Stat(filepath.Join(copyDir, "_site", "index.html")); err != nil {
+		t.Errorf("index.html should be written with --keep-going: %v", err)
+	}
+}
+
+func TestAtomicSwap(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# Index")
+
+	for _, dir := range []string{"._site.staging", "._site.old"} {
+		if err := os.Mkdir(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a build interrupted before it swapped the directories
+	createDummyFile(t, filepath.Join(tmpDir, "._site.staging", "index.html"), "half written")
+	// a build interrupted between the two renames, without an output directory
+	createDummyFile(t, filepath.Join(tmpDir, "._site.old", "mine.txt"), "previous site")
+
+	cmd := exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "_site", "mine.txt")); err != nil {
+		t.Errorf("The previous site should be restored: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(tmpDir, "_site", "index.html"))
+	if err != nil || strings.Contains(string(content), "half written") {
+		t.Errorf("index.html should be built again")
+	}
+
+	// the previous site is linked into the staging directory, not copied, and
+	// its files are replaced instead of written in place
+	if err := os.Link(filepath.Join(tmpDir, "_site", "index.html"), filepath.Join(tmpDir, "old.html")); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(filepath.Join(tmpDir, "_site", "mine.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the output directory is replaced, nothing is left next to it
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "# New Index")
+	cmd = exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+	content, err = os.ReadFile(filepath.Join(tmpDir, "_site", "index.html"))
+	if err != nil || !strings.Contains(string(content), "New Index") {
+		t.Errorf("index.html should be replaced")
+	}
+	content, err = os.ReadFile(filepath.Join(tmpDir, "old.html"))
+	if err != nil || strings.Contains(string(content), "New Index") {
+		t.Errorf("The previous index.html should not be written in place")
+	}
+	after, err := os.Stat(filepath.Join(tmpDir, "_site", "mine.txt"))
+	if err != nil || !os.SameFile(before, after) {
+		t.Errorf("mine.txt should be linked into the new site, not copied")
+	}
+	entries, _ := os.ReadDir(tmpDir)
+	for _, entry := range entries {
+		if entry.Name() == "._site.staging" || entry.Name() == "._site.old" {
+			t.Errorf("%s was left behind", entry.Name())
+		}
+	}
+	entries, _ = os.ReadDir(filepath.Join(tmpDir, "_site"))
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp") {
+			t.Errorf("The temporary file %s was left behind", entry.Name())
+		}
+	}
+}
+
+func TestGeneratedPages(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	createDummyFile(t, filepath.Join(tmpDir, "index.md"), "---\ntags: [golang]\n---\n# Index")
+	createDummyFile(t, filepath.Join(tmpDir, "_list.md"), "# My List")
+	if err := os.Mkdir(filepath.Join(tmpDir, "_tmp"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	createDummyFile(t, filepath.Join(tmpDir, "_tmp", "scratch.md"), "# Scratch")
+
+	cmd := exec.Command(mdwiBinaryAbsPath)
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("mdwi command failed: %v\nOutput: %s", err, string(output))
+	}
+
+	// the files of the user are left alone and built like any other page
+	if _, err := os.Stat(filepath.Join(tmpDir, "_list.md")); err != nil {
+		t.Errorf("_list.md should not be removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "_site", "_tmp", "scratch.html")); err != nil {
+		t.Errorf("The pages in _tmp should be built: %v", err)
+	}
+
+	// the generated pages are rendered without markdown files
+	for _, file := range []string{"list.html", "tags.html", "tag-golang.html"} {
+		if !strings.Contains(string(output), "Generated "+filepath.Join("_site", file)) {
+			t.Errorf("Expected %s to be generated, got: %s", file, string(output))
+		}
+	}
+	if strings.Contains(string(output), "Converted "+filepath.Join("_site", "_tmp")) {
+		t.Errorf("Did not expect a list.md file, got: %s", string(output))
+	}
+	content, err := os.ReadFile(filepath.Join(tmpDir, "_site", "list.html"))
+	if err != nil {
+		t.Fatalf("Failed to read list.html: %v", err)
+	}
+	for _, expected := range []string{"<title>List of Pages", `<a href="_tmp/scratch.html">`} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected %s in list.html", expected)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package wiki
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// DefaultAssets are the extensions of the files copied to the site whether a page
+// links to them or not, the assets option of the config file replaces them
+var DefaultAssets = []string{
+	".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".avif", ".ico",
+	".pdf", ".mp4", ".webm", ".mp3", ".zip",
+}
+
+// the extensions of the asset files, lower case and starting with a dot
+func (conf Config) assetExtensions() []string {
+
+	if conf.Assets == nil {
+		return DefaultAssets
+	}
+
+	var extensions []string
+	for _, ext := range conf.Assets {
+		extensions = append(extensions, "."+strings.ToLower(strings.TrimPrefix(ext, ".")))
+	}
+	return extensions
+}
+
+// check if a file has one of the asset extensions, in any case
+func (conf Config) isAsset(file string) bool {
+	return slices.Contains(conf.assetExtensions(), strings.ToLower(filepath.Ext(file))) && !privateFile(file)
+}
+
+// the files of mdwi and of other tools are never copied to the site: the layout,
+// the config file, the _site folders, and hidden files and folders such as .git
+// or the staging directory, other files and folders starting with an underscore
+// are copied
+func privateFile(file string) bool {
+
+	file = filepath.ToSlash(file)
+	if file == LayoutFile || slices.Contains(configFiles, file) {
+		return true
+	}
+	for _, part := range strings.Split(file, "/") {
+		if strings.HasPrefix(part, ".") || part == "_site" {
+			return true
+		}
+	}
+	return false
+}
+
+// check if a path is in the output directory, or in the staging directory the
+// site is built in, like the files findFiles skips
+func (b *Builder) outputFile(path string) bool {
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, dir := range []string{b.OutDir, b.target} {
+		if dir == "" {
+			continue
+		}
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(dir, abs); err == nil && filepath.IsLocal(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// find the files with the asset extensions, the paths are relative to the source directory
+func (b *Builder) listAssets() ([]string, error) {
+
+	files, err := b.findFiles("*")
+	if err != nil {
+		return nil, err
+	}
+
+	var assets []string
+	for _, file := range files {
+		if b.Config.isAsset(file) {
+			assets = append(assets, file)
+		}
+	}
+	return assets, nil
+}
+
+// record the file a markdown link or image of a page points at, if it is a
+// file of the wiki that isn't a page, links are relative to the folder of the page
+func (w *wiki) addAsset(file string, node ast.Node) {
+
+	var dest string
+	switch node := node.(type) {
+	case *ast.Link:
+		dest = string(node.Destination)
+	case *ast.Image:
+		dest = string(node.Destination)
+	default:
+		return
+	}
+
+	link, err := url.Parse(dest)
+	if err != nil || link.Scheme != "" || link.Host != "" || link.Path == "" || strings.HasPrefix(link.Path, "/") {
+		return
+	}
+
+	target := path.Join(path.Dir(filepath.ToSlash(file)), link.Path)
+	if !filepath.IsLocal(filepath.FromSlash(target)) || staticFile(target) {
+		return
+	}
+	switch strings.ToLower(path.Ext(target)) {
+	case ".md", ".html":
+		return
+	}
+
+	target = filepath.FromSlash(target)
+	info, err := os.Stat(w.srcPath(target))
+	if err != nil || !info.Mode().IsRegular() || !w.Config.includes(target) {
+		return
+	}
+
+	// the link works if the file is put in the output directory some other way
+	if privateFile(target) || w.outputFile(w.srcPath(target)) {
+		w.warn("Warning:", file, "links to", target+", which is not copied to the site")
+		return
+	}
+	w.assets[target] = true
+}
+
+// find the asset files of the wiki and the ones no page links to, the files of
+// the config file don't count as unused
+func (w *wiki) findAssets() error {
+
+	var err error
+	w.assetFiles, err = w.listAssets()
+	if err != nil {
+		return err
+	}
+
+	used := make(map[string]bool)
+	for _, file := range []string{w.Config.Favicon, w.Config.Stylesheet, w.Config.CustomCSS} {
+		if file != "" {
+			used[filepath.Clean(file)] = true
+		}
+	}
+
+	w.unused = nil
+	for _, file := range w.assetFiles {
+		if !w.assets[file] && !used[file] {
+			w.unused = append(w.unused, file)
+		}
+	}
+	return nil
+}
+
+// the asset files and the other files the pages link to, sorted
+func (w *wiki) siteAssets() []string {
+
+	files := slices.Clone(w.assetFiles)
+	for file := range w.assets {
+		if !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// copy the assets to the same place in the _site directory, the files that
+// can't be copied are added to w.failed
+func (w *wiki) copyAssets() {
+
+	for _, file := range w.siteAssets() {
+		dst := filepath.Join(w.OutDir, file)
+		err := copyFileAtomic(w.srcPath(file), dst)
+		if err != nil {
+			w.copyFailed(file, dst, fmt.Errorf("asset copy: %w", err))
+			continue
+		}
+		w.record(dst)
+		w.log("Copied", file, "to", dst)
+	}
+}
+
+// add a file that couldn't be copied to w.failed, keeping the copy of the
+// previous build if there is one
+func (w *wiki) copyFailed(file string, dst string, err error) {
+
+	w.failed = append(w.failed, PageError{File: file, Err: err})
+	if info, err := os.Stat(dst); err == nil && info.Mode().IsRegular() {
+		w.record(dst)
+	}
+}
+
+// print the asset files no page links to
+func (w *wiki) reportUnused() {
+
+	if len(w.unused) == 0 {
+		return
+	}
+
+	w.warn("Found", len(w.unused), "unused asset(s):")
+	for _, file := range w.unused {
+		w.warn(" ", file)
+	}
+}
@@ -0,0 +1,470 @@
+package wiki
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is the version of mdwi, shown in the footer of the generated pages
+const Version = "0.4.5"
+
+// Builder builds the wiki in a folder of markdown files into a static site
+// create it with NewBuilder, or fill in the fields directly, empty fields use
+// the defaults
+type Builder struct {
+	SrcDir     string    // folder with the markdown files, the current folder if empty
+	OutDir     string    // folder the site is written to, _site in SrcDir if empty
+	ConfigFile string    // config file the options were read from, empty if there is none
+	Config     Config    // options of the site
+	Hooks      []Hook    // steps finishing the HTML of every page, DefaultHooks if nil
+	LiveReload bool      // add the live reload script of the preview server to every page
+	Clean      bool      // remove all the files of the previous build first, not only the ones no longer generated
+	Jobs       int       // number of pages rendered at the same time, the number of CPUs if 0
+	Verbose    bool      // report which pages are taken from the build cache and which are rendered
+	KeepGoing  bool      // write the site even if some pages fail, keeping their previous version
+	Log        io.Writer // progress messages, discarded if nil
+	Warn       io.Writer // warnings and broken links, discarded if nil
+
+	layout       *template.Template // the parsed layout of the pages
+	layoutSource string             // the source of the layout, part of the hash of every page
+	cache        map[string]string  // page names mapped to the hash of their inputs when they were rendered
+	outputHashes map[string]string  // page names mapped to the hash of the HTML they were rendered to
+	previous     []string           // files written by the previous build, from the manifest
+	generated    map[string]bool    // files written by the current build, relative to OutDir
+	mu           sync.Mutex         // guards generated while pages are rendered in parallel
+	target       string             // the output directory while the build is written to a staging directory
+}
+
+// Report lists what was found while building or checking a wiki
+type Report struct {
+	Pages  int          // number of pages in the wiki
+	Broken []BrokenLink // wiki links pointing at pages or headings that don't exist
+	Unused []string     // asset files no page links to
+	Failed []PageError  // pages and files that failed to build
+}
+
+// PageError is a page, or a file copied to the site, that failed to build
+type PageError struct {
+	File string // markdown file of the page or the copied file, relative to SrcDir
+	Err  error  // what went wrong
+}
+
+func (e PageError) Error() string {
+	return e.File + ": " + e.Err.Error()
+}
+
+func (e PageError) Unwrap() error {
+	return e.Err
+}
+
+// BuildError is returned when pages or files fail to build, listing all of them
+type BuildError struct {
+	Failed []PageError
+}
+
+func (e *BuildError) Error() string {
+	msg := fmt.Sprintf("%d file(s) failed to build:", len(e.Failed))
+	for _, page := range e.Failed {
+		msg += "\n  " + page.Error()
+	}
+	return msg
+}
+
+// BrokenLink is a wiki link pointing at a page or heading that doesn't exist
+type BrokenLink struct {
+	File    string // markdown file containing the link
+	Target  string // page name the link points to
+	Heading string // heading the link points to, empty if the page itself is missing
+}
+
+func (link BrokenLink) String() string {
+	if link.Heading != "" {
+		return fmt.Sprintf("%s -> %s#%s (missing heading)", link.File, link.Target, link.Heading)
+	}
+	return link.File + " -> " + link.Target
+}
+
+// NewBuilder creates a builder for the wiki in src, with the options of its
+// config file, an empty out uses the output directory of the config file, or
+// _site in src
+func NewBuilder(src string, out string) (*Builder, error) {
+
+	conf, file, err := LoadConfig(src)
+	if err != nil {
+		return nil, err
+	}
+	if out == "" && conf.Output != "" {
+		out = configPath(src, conf.Output)
+	}
+
+	b := &Builder{SrcDir: src, OutDir: out, ConfigFile: file, Config: conf}
+	err = b.init()
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// fill in the fields left empty and check the directories and the config, which
+// can have been changed since NewBuilder, refusing an output directory that
+// would take the source files with it when it is re-created
+func (b *Builder) init() error {
+
+	if b.SrcDir == "" {
+		b.SrcDir = "."
+	}
+	if b.OutDir == "" {
+		b.OutDir = filepath.Join(b.SrcDir, "_site")
+	}
+	if b.Hooks == nil {
+		b.Hooks = DefaultHooks()
+	}
+
+	info, err := os.Stat(b.SrcDir)
+	if err != nil {
+		return fmt.Errorf("source directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("source directory %s is not a directory", b.SrcDir)
+	}
+
+	srcAbs, err := filepath.Abs(b.SrcDir)
+	if err != nil {
+		return err
+	}
+	outAbs, err := filepath.Abs(b.OutDir)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(outAbs, srcAbs)
+	if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("output directory %s contains the source directory %s", b.OutDir, b.SrcDir)
+	}
+
+	err = b.Config.check(b.SrcDir)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	return b.loadLayout()
+}
+
+// Build builds the whole wiki into OutDir, broken wiki links don't stop the
+// build and are listed in the report
+// the site is written to a staging directory which only replaces OutDir when
+// the build succeeds, pages that fail are returned in a *BuildError, and with
+// KeepGoing the site is written anyway, returning both the report and the error
+func (b *Builder) Build() (*Report, error) {
+
+	err := b.init()
+	if err != nil {
+		return nil, err
+	}
+
+	b.log("Generating wiki using mdwi version", Version, "...")
+
+	err = b.stageSite()
+	if err != nil {
+		return nil, err
+	}
+	defer b.unstageSite() // throw the staging directory away if the build fails
+
+	report, err := b.buildSite()
+	if err != nil && report == nil {
+		return nil, err
+	}
+
+	swapErr := b.swapSite()
+	if swapErr != nil {
+		return nil, swapErr
+	}
+	return report, err
+}
+
+// build the wiki into OutDir, returning the report with a *BuildError if pages
+// failed with KeepGoing
+func (b *Builder) buildSite() (*Report, error) {
+
+	err := b.prepareSite()
+	if err != nil {
+		return nil, err
+	}
+
+	// first pass: find all the pages and collect the links between them
+	w, err := b.loadWiki()
+	if err != nil {
+		return nil, err
+	}
+
+	// second pass: convert the markdown files that changed to HTML, several at a time
+	files := w.renderFiles()
+	for i, err := range w.renderChanged(files) {
+		if err != nil {
+			w.failed = append(w.failed, PageError{File: files[i], Err: err})
+		}
+	}
+	if len(w.failed) > 0 && !b.KeepGoing {
+		return nil, &BuildError{Failed: w.failed}
+	}
+	w.keepFailed()
+
+	// convert the list of pages to HTML
+	err = w.renderList()
+	if err != nil {
+		return nil, fmt.Errorf("list: %w", err)
+	}
+
+	// convert the tag overview and tag pages to HTML
+	err = w.renderTags()
+	if err != nil {
+		return nil, fmt.Errorf("tags: %w", err)
+	}
+
+	// write the search index
+	err = w.writeSearchIndex()
+	if err != nil {
+		return nil, fmt.Errorf("search index: %w", err)
+	}
+
+	// copy the images and other files the pages link to into the _site directory
+	w.copyAssets()
+
+	// copy the static folders last, their files win over generated ones
+	err = w.copyStatic()
+	if err != nil {
+		return nil, err
+	}
+	if len(w.failed) > 0 && !b.KeepGoing {
+		return nil, &BuildError{Failed: w.failed}
+	}
+
+	// remove what the previous build generated and this one didn't
+	err = b.closeSite()
+	if err != nil {
+		return nil, err
+	}
+
+	// report the links pointing at pages that don't exist, the embeds that can't
+	// be rendered and the unused assets
+	w.reportBroken()
+	w.reportEmbeds()
+	w.reportUnused()
+
+	if len(w.failed) > 0 {
+		return w.report(), &BuildError{Failed: w.failed}
+	}
+	return w.report(), nil
+}
+
+// Check reads all the pages and checks their front matter and wiki links,
+// without writing anything
+func (b *Builder) Check() (*Report, error) {
+
+	err := b.init()
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := b.loadWiki()
+	if err != nil {
+		return nil, err
+	}
+	if len(w.failed) > 0 {
+		return nil, &BuildError{Failed: w.failed}
+	}
+
+	w.reportBroken()
+	w.reportEmbeds()
+	w.reportUnused()
+	return w.report(), nil
+}
+
+// Standalone converts a markdown file into a self contained HTML file, with the
+// stylesheet, favicon and images inlined, the pages of the wiki are only read
+// for the pages it embeds
+// an empty output writes the standalone file of the config, or index.html in
+// OutDir, replacing the index page of the site if it was built there
+func (b *Builder) Standalone(input string, output string) error {
+
+	err := b.init()
+	if err != nil {
+		return err
+	}
+
+	output, err = b.standaloneOutput(input, output)
+	if err != nil {
+		return err
+	}
+
+	b.log("Generating standalone HTML file:", output)
+
+	// load the wiki the file is part of, so that embedded pages can be found
+	w, err := b.loadWiki()
+	if err != nil {
+		return err
+	}
+
+	err = w.markdownFile(input, output, b.standalonePage(input), true)
+	if err != nil {
+		return fmt.Errorf("%s: %w", input, err)
+	}
+	return nil
+}
+
+// RenderPage renders markdown into a self contained HTML page, like Standalone
+// without reading the wiki: wiki links point at the HTML files of the pages, and
+// relative images are inlined from SrcDir
+func (b *Builder) RenderPage(r io.Reader) ([]byte, error) {
+
+	err := b.init()
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("md read: %w", err)
+	}
+
+	return newWiki(b).renderMarkdown(input, &Page{Name: "index", Title: "index", Standalone: true})
+}
+
+// NewPage creates the markdown file of a new page with a front matter block and
+// returns its path, the name can include folders, e.g. notes/ideas, and the
+// title defaults to the last part of the name
+func (b *Builder) NewPage(name string, title string) (string, error) {
+
+	err := b.init()
+	if err != nil {
+		return "", err
+	}
+
+	name = strings.TrimSuffix(filepath.ToSlash(name), ".md")
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", fmt.Errorf("page name must be a path inside the wiki: %s", name)
+	}
+	if title == "" {
+		title = path.Base(name)
+	}
+
+	file := b.srcPath(filepath.FromSlash(name) + ".md")
+	if _, err := os.Stat(file); err == nil {
+		return "", fmt.Errorf("page already exists: %s", file)
+	}
+
+	content := fmt.Sprintf("---\ntitle: %q\ndate: %s\n---\n# %s\n\n", title, time.Now().Format("2006-01-02"), title)
+
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return "", fmt.Errorf("mkdir: %w", err)
+	}
+	err = b.writeFile(file, content)
+	if err != nil {
+		return "", fmt.Errorf("page write: %w", err)
+	}
+	return file, nil
+}
+
+// get the path of the standalone HTML file, by default index.html in the _site
+// directory, otherwise the given path, with its folder created if needed
+func (b *Builder) standaloneOutput(input_file string, output_file string) (string, error) {
+
+	if _, err := os.Stat(input_file); os.IsNotExist(err) {
+		return "", fmt.Errorf("input file does not exist: %s", input_file)
+	}
+
+	if output_file == "" && b.Config.Standalone != "" {
+		output_file = configPath(b.SrcDir, b.Config.Standalone)
+	}
+
+	if output_file == "" {
+		output_file = filepath.Join(b.OutDir, "index.html")
+	}
+
+	inAbs, inErr := filepath.Abs(input_file)
+	outAbs, outErr := filepath.Abs(output_file)
+	if inErr == nil && outErr == nil && inAbs == outAbs {
+		return "", fmt.Errorf("the output file would overwrite the input file: %s", input_file)
+	}
+
+	err := os.MkdirAll(filepath.Dir(output_file), 0755)
+	if err != nil {
+		return "", fmt.Errorf("mkdir: %w", err)
+	}
+	return output_file, nil
+}
+
+// get the page name of a markdown file given on the command line, relative to
+// the source directory if possible
+func (b *Builder) standalonePage(input_file string) string {
+
+	abs, err := filepath.Abs(input_file)
+	if err != nil {
+		return pageName(input_file)
+	}
+	src, err := filepath.Abs(b.SrcDir)
+	if err != nil {
+		return pageName(input_file)
+	}
+	rel, err := filepath.Rel(src, abs)
+	if err != nil {
+		return pageName(input_file)
+	}
+	return pageName(rel)
+}
+
+// get the path of a file named in the config file, relative paths are relative to the wiki root
+func configPath(src string, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(src, file)
+}
+
+// get the path of a file of the wiki, given relative to the source directory
+func (b *Builder) srcPath(file string) string {
+	return filepath.Join(b.SrcDir, file)
+}
+
+// print a progress message
+func (b *Builder) log(a ...any) {
+	if b.Log != nil {
+		fmt.Fprintln(b.Log, b.displayPaths(a)...)
+	}
+}
+
+// print a warning
+func (b *Builder) warn(a ...any) {
+	if b.Warn != nil {
+		fmt.Fprintln(b.Warn, b.displayPaths(a)...)
+	}
+}
+
+func (b *Builder) writeFile(path string, content string) error {
+
+	err := writeFileAtomic(path, []byte(content))
+	if err != nil {
+		return err
+	}
+	b.log("Created", path)
+	return nil
+}
+
+// write a generated file to the output directory, the name is relative to OutDir
+func (b *Builder) writeOutput(name string, content string) error {
+
+	path := filepath.Join(b.OutDir, name)
+	err := b.writeFile(path, content)
+	if err != nil {
+		return err
+	}
+	b.record(path)
+	return nil
+}
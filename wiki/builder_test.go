@@ -0,0 +1,122 @@
+package wiki
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func createFile(t *testing.T, path, content string) {
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create file %s: %v", path, err)
+	}
+}
+
+func TestRenderPage(t *testing.T) {
+	b := &Builder{SrcDir: t.TempDir()}
+
+	output, err := b.RenderPage(strings.NewReader("---\ntitle: Notes\n---\n# Notes\n\nSee {{other page}}."))
+	if err != nil {
+		t.Fatalf("RenderPage failed: %v", err)
+	}
+
+	for _, expected := range []string{
+		"<title>Notes</title>",
+		`<a href="other-page.html">other page</a>`,
+		"<style>",
+		"<main>",
+	} {
+		if !strings.Contains(string(output), expected) {
+			t.Errorf("Expected %s in the rendered page", expected)
+		}
+	}
+	if strings.Contains(string(output), "Table of Contents") {
+		t.Errorf("Rendered pages should not have the sidebar links")
+	}
+}
+
+func TestBuild(t *testing.T) {
+	src := t.TempDir()
+	createFile(t, filepath.Join(src, "index.md"), "# Index\n\nLinks to {{guide}} and {{missing}}.")
+	createFile(t, filepath.Join(src, "guide.md"), "# Guide")
+
+	b, err := NewBuilder(src, "")
+	if err != nil {
+		t.Fatalf("NewBuilder failed: %v", err)
+	}
+
+	report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if report.Pages != 2 {
+		t.Errorf("Expected 2 pages, got %d", report.Pages)
+	}
+	if len(report.Broken) != 1 || report.Broken[0].String() != "index.md -> missing" {
+		t.Errorf("Unexpected broken links: %v", report.Broken)
+	}
+	if _, err := os.Stat(filepath.Join(src, "_site", "guide.html")); err != nil {
+		t.Errorf("guide.html was not created: %v", err)
+	}
+
+	// errors are returned instead of exiting
+	createFile(t, filepath.Join(src, "broken.md"), "---\ntitle: [unclosed\n---\n# Broken")
+	_, err = b.Build()
+	if err == nil || !strings.Contains(err.Error(), "broken.md") {
+		t.Errorf("Expected an error naming broken.md, got: %v", err)
+	}
+	var buildErr *BuildError
+	if !errors.As(err, &buildErr) || len(buildErr.Failed) != 1 || buildErr.Failed[0].File != "broken.md" {
+		t.Errorf("Expected a BuildError listing broken.md, got: %#v", err)
+	}
+
+	// with KeepGoing the other pages are written, and the failed page is reported
+	b.KeepGoing = true
+	report, err = b.Build()
+	if err == nil || report == nil || len(report.Failed) != 1 {
+		t.Errorf("Expected a report and an error with KeepGoing, got: %v, %v", report, err)
+	}
+
+	// the first build of watch mode prints the failed pages instead
+	var warnings bytes.Buffer
+	b.Warn = &warnings
+	_, err = b.initialBuild()
+	if err != nil || !strings.Contains(warnings.String(), "Error (broken.md): invalid front matter") {
+		t.Errorf("Expected broken.md to be reported, got: %v, %s", err, warnings.String())
+	}
+
+	_, err = NewBuilder(filepath.Join(src, "nowhere"), "")
+	if err == nil {
+		t.Errorf("Expected an error for a missing source directory")
+	}
+}
+
+func TestHooks(t *testing.T) {
+	src := t.TempDir()
+	createFile(t, filepath.Join(src, "index.md"), "# Index")
+
+	banner := func(b *Builder, page *Page, html string) (string, error) {
+		return strings.Replace(html, "<body>", "<body><div class=\"banner\">"+page.Name+"</div>", 1), nil
+	}
+
+	b := &Builder{SrcDir: src, Hooks: append(DefaultHooks(), banner)}
+	_, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(src, "_site", "index.html"))
+	if err != nil {
+		t.Fatalf("Failed to read index.html: %v", err)
+	}
+	if !strings.Contains(string(content), `<div class="banner">index</div>`) {
+		t.Errorf("The custom hook was not run")
+	}
+	if !strings.Contains(string(content), "<footer>") {
+		t.Errorf("The page was not put into the layout")
+	}
+}
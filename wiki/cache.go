@@ -0,0 +1,224 @@
+package wiki
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// CacheFile is the file in the output directory with a hash of the inputs of
+// every page, so that the next build only renders the pages whose inputs changed
+const CacheFile = ".mdwi-cache.json"
+
+// buildCache is the contents of the cache file
+type buildCache struct {
+	Version string            `json:"version"` // version of mdwi that rendered the pages
+	Pages   map[string]string `json:"pages"`   // page names mapped to the hash of their inputs
+	Outputs map[string]string `json:"outputs"` // page names mapped to the hash of their HTML files
+}
+
+// read the hashes of the pages rendered by the previous build, a clean build
+// or a cache written by another version of mdwi starts over
+func (b *Builder) loadCache() {
+
+	b.cache = make(map[string]string)
+	b.outputHashes = make(map[string]string)
+	if b.Clean {
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(b.OutDir, CacheFile))
+	if err != nil {
+		return
+	}
+
+	var c buildCache
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		b.warn("Warning: ignoring the build cache:", err)
+		return
+	}
+	if c.Version == Version && c.Pages != nil && c.Outputs != nil {
+		b.cache = c.Pages
+		b.outputHashes = c.Outputs
+	}
+}
+
+// write the hashes of the pages of the wiki that were rendered
+func (w *wiki) saveCache() error {
+
+	c := buildCache{Version: Version, Pages: make(map[string]string), Outputs: make(map[string]string)}
+	for name, key := range w.cache {
+		if w.pages[name] && w.outputHashes[name] != "" {
+			c.Pages[name] = key
+			c.Outputs[name] = w.outputHashes[name]
+		}
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cache: %w", err)
+	}
+	err = writeFileAtomic(filepath.Join(w.OutDir, CacheFile), data)
+	if err != nil {
+		return fmt.Errorf("cache write: %w", err)
+	}
+	return nil
+}
+
+// write a value to a hash, followed by a separator so that values can't run together
+func hashValue(h hash.Hash, values ...any) {
+	for _, value := range values {
+		fmt.Fprint(h, value, "\x00")
+	}
+}
+
+// the hash of the inputs shared by all the pages: the version of mdwi, the
+// config, the layout and whether the pages get the live reload script
+func (w *wiki) siteHash() string {
+
+	if w.siteKey != "" {
+		return w.siteKey
+	}
+
+	config, err := json.Marshal(w.Config)
+	if err != nil {
+		config = nil // can't happen, but then the config is just not part of the hash
+	}
+
+	h := sha256.New()
+	hashValue(h, Version, string(config), w.layoutSource, w.LiveReload)
+	w.siteKey = hex.EncodeToString(h.Sum(nil))
+	return w.siteKey
+}
+
+// the hash of the contents of a file, empty if it can't be read
+func fileHash(path string) string {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// the hash of the markdown file of a page, empty if it can't be read
+func (w *wiki) sourceHash(name string) string {
+
+	if hash, ok := w.sourceHashes[name]; ok {
+		return hash
+	}
+
+	hash := fileHash(w.srcPath(filepath.FromSlash(name) + ".md"))
+	w.sourceHashes[name] = hash
+	return hash
+}
+
+// the hash of everything the HTML of a page depends on: the inputs shared by
+// all the pages, the markdown of the page and of the pages it embeds, whether
+// the pages they link to and embed exist, and the pages linking back to it with
+// their titles
+func (w *wiki) pageKey(name string) string {
+
+	h := sha256.New()
+	hashValue(h, w.siteHash(), name)
+
+	hashValue(h, "backlinks")
+	for _, page := range w.backlinks[name] {
+		hashValue(h, page, w.title(page))
+	}
+
+	// the page and the pages it embeds, directly or through other pages
+	pages := []string{name}
+	for i := 0; i < len(pages); i++ {
+		for _, target := range w.embeds[pages[i]] {
+			if w.pages[target] && !slices.Contains(pages, target) {
+				pages = append(pages, target)
+			}
+		}
+	}
+
+	for _, page := range pages {
+		hashValue(h, "page", page, w.sourceHash(page))
+		for _, target := range w.links[page] {
+			hashValue(h, "link", target, w.pages[target])
+		}
+		for _, target := range w.embeds[page] {
+			hashValue(h, "embed", target, w.pages[target])
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// render the pages whose inputs changed since they were last rendered, the
+// others keep the HTML of the previous build unless it was changed or removed
+// since, the errors are returned in the order of the files like renderPages
+func (w *wiki) renderChanged(files []string) []error {
+
+	keys := make([]string, len(files))
+	var render []string // the files to render
+	var index []int     // their index in files
+	hits := 0
+
+	for i, file := range files {
+		name := pageName(file)
+		keys[i] = w.pageKey(name)
+
+		reason := ""
+		if cached, ok := w.cache[name]; !ok {
+			reason = "not cached"
+		} else if cached != keys[i] {
+			reason = "changed"
+		} else if hash := fileHash(w.outputPath(name)); hash == "" {
+			reason = "output missing"
+		} else if hash != w.outputHashes[name] {
+			reason = "output changed"
+		}
+
+		if reason == "" {
+			hits++
+			w.record(w.outputPath(name))
+			if w.Verbose {
+				w.log("Cache hit:", file)
+			}
+			continue
+		}
+
+		if w.Verbose {
+			w.log("Cache miss:", file, "("+reason+")")
+		}
+		render = append(render, file)
+		index = append(index, i)
+	}
+
+	errs := make([]error, len(files))
+	for j, err := range w.renderPages(render) {
+		i := index[j]
+		errs[i] = err
+		name := pageName(files[i])
+		if err != nil {
+			delete(w.cache, name)
+			delete(w.outputHashes, name)
+		} else {
+			w.cache[name] = keys[i]
+			w.outputHashes[name] = fileHash(w.outputPath(name))
+		}
+	}
+
+	if hits > 0 {
+		w.log("Reused", hits, "unchanged page(s) from the cache")
+	}
+
+	err := w.saveCache()
+	if err != nil {
+		w.warn("Error:", err)
+	}
+	return errs
+}
@@ -0,0 +1,345 @@
+package wiki
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gomarkdown/markdown/parser"
+	"gopkg.in/yaml.v3"
+)
+
+// configFiles are the names of the config file in the wiki root, only one of them can exist
+var configFiles = []string{"mdwi.toml", "mdwi.yaml", "mdwi.yml"}
+
+// Config holds the options of a site, usually read from the config file with
+// LoadConfig, empty options keep the built in defaults
+type Config struct {
+	Title      string    `yaml:"title" toml:"title"`           // shown in the navigation and the page titles
+	Footer     string    `yaml:"footer" toml:"footer"`         // HTML replacing the text of the footer
+	Nav        []NavLink `yaml:"nav" toml:"nav"`               // links replacing the default navigation links
+	Theme      string    `yaml:"theme" toml:"theme"`           // built in theme of the default stylesheet, overridden by --theme
+	Stylesheet string    `yaml:"stylesheet" toml:"stylesheet"` // css file replacing the default stylesheet
+	CustomCSS  string    `yaml:"custom_css" toml:"custom_css"` // css file added to the end of the stylesheet
+	Favicon    string    `yaml:"favicon" toml:"favicon"`       // svg, png or ico file replacing the default favicon
+	Extensions []string  `yaml:"extensions" toml:"extensions"` // markdown extensions to add, or to remove with a no- prefix
+	Assets     []string  `yaml:"assets" toml:"assets"`         // extensions of the files copied to the site, DefaultAssets if empty
+	Include    []string  `yaml:"include" toml:"include"`       // globs of the files to build, all files if empty
+	Exclude    []string  `yaml:"exclude" toml:"exclude"`       // globs of the files to leave out
+	Output     string    `yaml:"output" toml:"output"`         // output directory, overridden by --out
+	Standalone string    `yaml:"standalone" toml:"standalone"` // standalone output file, overridden by -o
+
+	stylesheet  string // contents of the stylesheet file
+	customCSS   string // contents of the custom css file
+	favicon     []byte // contents of the favicon file
+	faviconType string // MIME type of the favicon file
+}
+
+// NavLink is a link in the navigation sidebar
+type NavLink struct {
+	Title string `yaml:"title" toml:"title"`
+	URL   string `yaml:"url" toml:"url"`
+}
+
+// markdownExtensions maps the extension names used in the config file to the parser extensions
+var markdownExtensions = map[string]parser.Extensions{
+	"no-intra-emphasis":          parser.NoIntraEmphasis,
+	"tables":                     parser.Tables,
+	"fenced-code":                parser.FencedCode,
+	"autolink":                   parser.Autolink,
+	"strikethrough":              parser.Strikethrough,
+	"lax-html-blocks":            parser.LaxHTMLBlocks,
+	"space-headings":             parser.SpaceHeadings,
+	"hard-line-break":            parser.HardLineBreak,
+	"non-blocking-space":         parser.NonBlockingSpace,
+	"tab-size-eight":             parser.TabSizeEight,
+	"footnotes":                  parser.Footnotes,
+	"no-empty-line-before-block": parser.NoEmptyLineBeforeBlock,
+	"heading-ids":                parser.HeadingIDs,
+	"titleblock":                 parser.Titleblock,
+	"auto-heading-ids":           parser.AutoHeadingIDs,
+	"backslash-line-break":       parser.BackslashLineBreak,
+	"definition-lists":           parser.DefinitionLists,
+	"mathjax":                    parser.MathJax,
+	"ordered-list-start":         parser.OrderedListStart,
+	"attributes":                 parser.Attributes,
+	"super-subscript":            parser.SuperSubscript,
+	"empty-lines-break-list":     parser.EmptyLinesBreakList,
+}
+
+// the markdown extensions used when the config file doesn't change them
+const defaultExtensions = parser.CommonExtensions | parser.AutoHeadingIDs
+
+// LoadConfig reads and checks the config file in the given directory, returning
+// the options and the path of the file, or the defaults and an empty path if
+// there is no config file
+func LoadConfig(dir string) (Config, string, error) {
+
+	var conf Config
+
+	// find the config file
+	var file string
+	for _, name := range configFiles {
+		candidate := filepath.Join(dir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			if file != "" {
+				return conf, "", fmt.Errorf("found both %s and %s, only one config file can be used", file, candidate)
+			}
+			file = candidate
+		}
+	}
+	if file == "" {
+		return conf, "", nil
+	}
+
+	input, err := os.ReadFile(file)
+	if err != nil {
+		return conf, "", err
+	}
+
+	err = decodeConfig(input, strings.HasSuffix(file, ".toml"), &conf)
+	if err != nil {
+		return conf, "", fmt.Errorf("%s: %w", file, err)
+	}
+
+	err = conf.check(dir)
+	if err != nil {
+		return conf, "", fmt.Errorf("%s: %w", file, err)
+	}
+
+	return conf, file, nil
+}
+
+// decode a TOML or YAML config file, rejecting options that don't exist
+func decodeConfig(input []byte, isTOML bool, conf *Config) error {
+
+	var raw map[string]any
+	var err error
+	if isTOML {
+		_, err = toml.Decode(string(input), &raw)
+	} else {
+		err = yaml.Unmarshal(input, &raw)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	err = checkKeys(raw, reflect.TypeOf(Config{}), "")
+	if err != nil {
+		return err
+	}
+
+	// the nav links are the only nested options
+	var links []map[string]any
+	switch nav := raw["nav"].(type) {
+	case []map[string]any:
+		links = nav
+	case []any:
+		for i, item := range nav {
+			link, ok := item.(map[string]any)
+			if !ok {
+				return fmt.Errorf("nav[%d]: expected a title and a url", i)
+			}
+			links = append(links, link)
+		}
+	}
+	for i, link := range links {
+		err = checkKeys(link, reflect.TypeOf(NavLink{}), fmt.Sprintf("nav[%d].", i))
+		if err != nil {
+			return err
+		}
+	}
+
+	if isTOML {
+		_, err = toml.Decode(string(input), conf)
+	} else {
+		err = yaml.Unmarshal(input, conf)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return nil
+}
+
+// check that all the keys are options of the given struct type
+func checkKeys(raw map[string]any, t reflect.Type, prefix string) error {
+
+	known := make(map[string]bool)
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		if name := t.Field(i).Tag.Get("yaml"); name != "" {
+			known[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for key := range raw {
+		if !known[key] {
+			sort.Strings(names)
+			return fmt.Errorf("unknown option %q, the options are: %s", prefix+key, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// check the options and read the files they point at, paths are relative to dir
+func (conf *Config) check(dir string) error {
+
+	for i, link := range conf.Nav {
+		if link.Title == "" || link.URL == "" {
+			return fmt.Errorf("nav[%d]: links need both a title and a url", i)
+		}
+	}
+
+	for _, name := range conf.Extensions {
+		if _, ok := markdownExtensions[strings.TrimPrefix(name, "no-")]; !ok {
+			return fmt.Errorf("unknown markdown extension %q", name)
+		}
+	}
+
+	for _, ext := range conf.Assets {
+		if strings.Trim(ext, ".") == "" || strings.ContainsAny(ext, `/\*?[`) {
+			return fmt.Errorf("invalid asset extension %q", ext)
+		}
+	}
+
+	for _, pattern := range append(append([]string{}, conf.Include...), conf.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+	}
+
+	if conf.Stylesheet != "" {
+		stylesheet, err := os.ReadFile(filepath.Join(dir, conf.Stylesheet))
+		if err != nil {
+			return fmt.Errorf("stylesheet: %w", err)
+		}
+		conf.stylesheet = string(stylesheet)
+	}
+
+	if conf.Theme != "" && !slices.Contains(Themes(), conf.Theme) {
+		return fmt.Errorf("unknown theme %q, the themes are: %s", conf.Theme, strings.Join(Themes(), ", "))
+	}
+
+	if conf.CustomCSS != "" {
+		customCSS, err := os.ReadFile(filepath.Join(dir, conf.CustomCSS))
+		if err != nil {
+			return fmt.Errorf("custom_css: %w", err)
+		}
+		conf.customCSS = string(customCSS)
+	}
+
+	if conf.Favicon != "" {
+		switch strings.ToLower(filepath.Ext(conf.Favicon)) {
+		case ".svg":
+			conf.faviconType = "image/svg+xml"
+		case ".png":
+			conf.faviconType = "image/png"
+		case ".ico":
+			conf.faviconType = "image/x-icon"
+		default:
+			return fmt.Errorf("favicon: %s is not an svg, png or ico file", conf.Favicon)
+		}
+		favicon, err := os.ReadFile(filepath.Join(dir, conf.Favicon))
+		if err != nil {
+			return fmt.Errorf("favicon: %w", err)
+		}
+		conf.favicon = favicon
+	}
+
+	return nil
+}
+
+// the parser extensions: the defaults, with Extensions added, or removed with a no- prefix
+func (conf Config) parserExtensions() parser.Extensions {
+
+	extensions := defaultExtensions
+	for _, name := range conf.Extensions {
+		if ext, ok := markdownExtensions[name]; ok {
+			extensions |= ext
+		} else if ext, ok := markdownExtensions[strings.TrimPrefix(name, "no-")]; ok {
+			extensions &^= ext
+		}
+	}
+	return extensions
+}
+
+// the contents of the stylesheet: the stylesheet file or the default stylesheet
+// with the colors of the theme, followed by the custom css
+func (conf Config) stylesheetString() string {
+
+	stylesheet := conf.stylesheet
+	if stylesheet == "" {
+		theme := conf.Theme
+		if theme == "" {
+			theme = DefaultTheme
+		}
+		stylesheet = generateStylesheetString(theme)
+	}
+
+	if conf.customCSS != "" {
+		stylesheet += "\n\n/* " + conf.CustomCSS + " */\n" + conf.customCSS
+	}
+	return stylesheet
+}
+
+// the MIME type of the favicon
+func (conf Config) faviconMIME() string {
+	if conf.favicon == nil {
+		return "image/svg+xml"
+	}
+	return conf.faviconType
+}
+
+// the favicon as a data URI, for standalone files
+func (conf Config) faviconDataURI() string {
+	favicon := conf.favicon
+	if favicon == nil {
+		favicon = []byte(generateFavicon())
+	}
+	return "data:" + conf.faviconMIME() + ";base64," + base64.StdEncoding.EncodeToString(favicon)
+}
+
+// the file name of the favicon in the _site directory
+func (conf Config) faviconName() string {
+	if conf.favicon == nil {
+		return "favicon.svg"
+	}
+	return "favicon" + strings.ToLower(filepath.Ext(conf.Favicon))
+}
+
+// check if a file of the wiki, given relative to the wiki root, should be built
+// a pattern matches the file, or one of the folders it is in
+func (conf Config) includes(file string) bool {
+
+	if len(conf.Include) > 0 && !matchGlobs(conf.Include, file) {
+		return false
+	}
+	return !matchGlobs(conf.Exclude, file)
+}
+
+// check if any of the patterns matches the slash separated path or one of its folders,
+// patterns without a slash are also matched against the base names
+func matchGlobs(patterns []string, file string) bool {
+
+	for p := filepath.ToSlash(file); p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+			if !strings.Contains(pattern, "/") {
+				if ok, _ := path.Match(pattern, path.Base(p)); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package wiki
+
+import (
+	"bytes"
+	"fmt"
+	stdhtml "html"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+)
+
+// embedPattern matches embeds of other pages such as {{!Name}}, or of a single
+// section of another page such as {{!Name#Heading}}
+const embedPattern = `\{\{!([^{}|#\n]+)(?:#([^{}|\n]+))?\}\}`
+
+var embedRegexp = regexp.MustCompile(embedPattern)
+
+// embedPlaceholderPattern matches the placeholders embeds are replaced with
+// while the markdown is rendered, including the paragraph around them
+const embedPlaceholderPattern = `(?:<p>)?mdwiembed(\d+)x(?:</p>)?`
+
+var embedPlaceholderRegexp = regexp.MustCompile(embedPlaceholderPattern)
+
+// how many levels of pages embedding other pages are allowed
+const maxEmbedDepth = 8
+
+// embedProblem is an embed of an existing page that can't be rendered, a cycle
+// or embeds nested too deep
+type embedProblem struct {
+	from   string // the page with the embed
+	target string // the embedded page
+	msg    string
+}
+
+// replace the embeds in markdown content with placeholders, returning the new
+// content and the embeds in the order of the placeholders
+func protectEmbeds(input []byte) ([]byte, []string) {
+
+	var embeds []string
+	output := embedRegexp.ReplaceAllFunc(input, func(match []byte) []byte {
+		embeds = append(embeds, string(match))
+		return []byte(fmt.Sprintf("mdwiembed%dx", len(embeds)-1))
+	})
+
+	return output, embeds
+}
+
+// replace the placeholders created by protectEmbeds using the replace function,
+// which gets the original embed
+func restoreEmbeds(content string, embeds []string, replace func(string) string) string {
+
+	return embedPlaceholderRegexp.ReplaceAllStringFunc(content, func(placeholder string) string {
+		submatches := embedPlaceholderRegexp.FindStringSubmatch(placeholder)
+		i, err := strconv.Atoi(submatches[1])
+		if err != nil || i >= len(embeds) {
+			return placeholder
+		}
+
+		// an embed on a line of its own replaces the whole paragraph, otherwise
+		// keep whatever part of the paragraph tags was matched
+		replacement := replace(embeds[i])
+		if strings.HasPrefix(placeholder, "<p>") && !strings.HasSuffix(placeholder, "</p>") {
+			replacement = "<p>" + replacement
+		} else if !strings.HasPrefix(placeholder, "<p>") && strings.HasSuffix(placeholder, "</p>") {
+			replacement += "</p>"
+		}
+		return replacement
+	})
+}
+
+// split an embed such as {{!Name#Heading}} into the page name and heading
+func splitEmbed(embed string) (name string, heading string) {
+
+	submatches := embedRegexp.FindStringSubmatch(embed)
+	return strings.TrimSpace(submatches[1]), strings.TrimSpace(submatches[2])
+}
+
+// render the page (or section of the page) named by the embed as HTML
+// from is the page containing the embed, used to resolve the name, and stack
+// lists the pages being embedded, starting with the page being written
+func (w *wiki) embedHTML(embed string, from string, root string, inline bool, stack []string) string {
+
+	name, section := splitEmbed(embed)
+	target := w.resolveLink(from, name)
+
+	// report problems in the page itself as well as on the console, the problems
+	// of the pages of the site are reported by checkEmbeds when the wiki is
+	// loaded, so that the pages taken from the cache report them as well
+	embedError := func(msg string) string {
+		if inline {
+			w.warn("Warning:", from, "embeds", name+":", msg)
+		}
+		return fmt.Sprintf(`<div class="embed-error">%s: %s</div>`, stdhtml.EscapeString(embed), stdhtml.EscapeString(msg))
+	}
+
+	if !w.pages[target] {
+		return embedError("page does not exist")
+	}
+	if slices.Contains(stack, target) {
+		return embedError("embed cycle " + strings.Join(append(stack, target), " -> "))
+	}
+	if len(stack) > maxEmbedDepth {
+		return embedError(fmt.Sprintf("embeds are nested more than %d levels deep", maxEmbedDepth))
+	}
+
+	input, err := os.ReadFile(w.srcPath(filepath.FromSlash(target) + ".md"))
+	if err != nil {
+		return embedError(err.Error())
+	}
+
+	_, input, err = splitFrontMatter(input)
+	if err != nil {
+		return embedError(err.Error())
+	}
+
+	input, embeds := protectEmbeds(input)
+	input, links := protectLinks(input)
+
+	doc := w.parseMarkdown(input)
+
+	if section != "" {
+		doc = extractSection(doc, headingID(section))
+		if doc == nil {
+			return embedError("heading " + section + " does not exist")
+		}
+	}
+
+	// relative links and images of the embedded page are relative to its folder,
+	// which may not be the folder of the page being written
+	rebaseURLs(doc, relativeFolder(stack[0], target))
+
+	if !inline {
+		linkInlineTags(doc, root)
+	}
+
+	renderer := html.NewRenderer(html.RendererOptions{Flags: html.CommonFlags})
+	fragment := string(markdown.Render(doc, renderer))
+
+	fragment = restoreLinks(fragment, links, func(link string) string {
+		return w.linkHTML(link, target, root, inline)
+	})
+	fragment = restoreEmbeds(fragment, embeds, func(embed string) string {
+		return w.embedHTML(embed, target, root, inline, append(stack, target))
+	})
+
+	return `<div class="embed">` + fragment + `</div>`
+}
+
+// find the embed cycles and the embeds nested too deep, following the embeds
+// of every page the same way embedHTML does, the embeds of missing pages and
+// sections are broken links
+func (w *wiki) checkEmbeds() {
+
+	seen := make(map[embedProblem]bool)
+
+	var follow func(stack []string)
+	follow = func(stack []string) {
+		from := stack[len(stack)-1]
+		for _, target := range w.embeds[from] {
+			if !w.pages[target] {
+				continue
+			}
+
+			problem := embedProblem{from: from, target: target}
+			if slices.Contains(stack, target) {
+				problem.msg = "embed cycle " + strings.Join(append(slices.Clone(stack), target), " -> ")
+			} else if len(stack) > maxEmbedDepth {
+				problem.msg = fmt.Sprintf("embeds are nested more than %d levels deep", maxEmbedDepth)
+			} else {
+				follow(append(slices.Clone(stack), target))
+				continue
+			}
+
+			if !seen[problem] {
+				seen[problem] = true
+				w.embedProblems = append(w.embedProblems, problem)
+			}
+		}
+	}
+
+	for _, file := range w.files {
+		follow([]string{pageName(file)})
+	}
+}
+
+// print the embeds that can't be rendered
+func (w *wiki) reportEmbeds() {
+	for _, problem := range w.embedProblems {
+		w.warn("Warning:", problem.from, "embeds", problem.target+":", problem.msg)
+	}
+}
+
+// cut a document down to the heading with the given ID and everything up to
+// the next heading of the same or a higher level, nil if there is no such heading
+func extractSection(doc ast.Node, id string) ast.Node {
+
+	var section []ast.Node
+	level := 0
+
+	for _, child := range doc.GetChildren() {
+		heading, isHeading := child.(*ast.Heading)
+		if level == 0 {
+			if isHeading && heading.HeadingID == id {
+				level = heading.Level
+				section = append(section, child)
+			}
+			continue
+		}
+		if isHeading && heading.Level <= level {
+			break
+		}
+		section = append(section, child)
+	}
+
+	if len(section) == 0 {
+		return nil
+	}
+
+	// ast.AppendChild would drop the children of the moved nodes
+	result := &ast.Document{}
+	for _, child := range section {
+		child.SetParent(result)
+	}
+	result.SetChildren(section)
+	return result
+}
+
+// get the relative path from the folder of one page to the folder of another,
+// with a trailing slash, or an empty string if they are in the same folder
+func relativeFolder(from string, to string) string {
+
+	rel, err := filepath.Rel(filepath.FromSlash(path.Dir(from)), filepath.FromSlash(path.Dir(to)))
+	if err != nil || rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel) + "/"
+}
+
+// prefix the relative link and image URLs in a document
+func rebaseURLs(doc ast.Node, prefix string) {
+
+	if prefix == "" {
+		return
+	}
+
+	rebase := func(dest []byte) []byte {
+		if len(dest) == 0 || dest[0] == '#' || dest[0] == '/' || bytes.Contains(dest, []byte(":")) {
+			return dest // fragments, absolute paths and URLs with a scheme
+		}
+		return append([]byte(prefix), dest...)
+	}
+
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.Link:
+			n.Destination = rebase(n.Destination)
+		case *ast.Image:
+			n.Destination = rebase(n.Destination)
+		}
+		return ast.GoToNext
+	})
+}
@@ -0,0 +1,193 @@
+package wiki
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// StandaloneFollow is like Standalone, but also includes every page reachable
+// from the input file through wiki links, with each page as a section of the
+// file, the input file has to be a page of the wiki
+func (b *Builder) StandaloneFollow(input_file string, output_file string) error {
+
+	err := b.init()
+	if err != nil {
+		return err
+	}
+
+	output_file, err = b.standaloneOutput(input_file, output_file)
+	if err != nil {
+		return err
+	}
+
+	b.log("Generating standalone HTML file:", output_file)
+
+	w, err := b.loadWiki()
+	if err != nil {
+		return err
+	}
+
+	start := b.standalonePage(input_file)
+	if !w.pages[start] {
+		return fmt.Errorf("input file is not a page of the wiki in the source directory: %s", input_file)
+	}
+
+	pages := w.reachablePages(start)
+
+	// give every page a unique section ID, so links between them can be rewritten
+	w.anchors = make(map[string]string)
+	used := make(map[string]bool)
+	for _, page := range pages {
+		base := headingID(page)
+		anchor := base
+		for n := 2; used[anchor]; n++ {
+			anchor = base + "-" + strconv.Itoa(n)
+		}
+		used[anchor] = true
+		w.anchors[page] = anchor
+	}
+
+	// combine the pages into one document, keeping the rendered wiki links and
+	// embeds of all the pages in one list each
+	var children []ast.Node
+	var links, embeds []string
+	for _, page := range pages {
+
+		input, err := os.ReadFile(b.srcPath(filepath.FromSlash(page) + ".md"))
+		if err != nil {
+			return fmt.Errorf("md read: %w", err)
+		}
+		_, input, err = splitFrontMatter(input)
+		if err != nil {
+			return fmt.Errorf("%s: %w", page, err)
+		}
+
+		input, pageEmbeds := protectEmbeds(input)
+		input, pageLinks := protectLinks(input)
+		input = shiftPlaceholders(input, "mdwiembed", len(embeds))
+		input = shiftPlaceholders(input, "mdwilink", len(links))
+
+		for _, link := range pageLinks {
+			links = append(links, w.linkHTML(link, page, "", true))
+		}
+		for _, embed := range pageEmbeds {
+			embeds = append(embeds, w.embedHTML(embed, page, "", true, []string{page}))
+		}
+
+		section := b.parseMarkdown(input)
+		prefixHeadingIDs(section, w.anchors[page]+"--")
+
+		// images are inlined relative to the folder of the first page
+		rebaseURLs(section, relativeFolder(start, page))
+
+		children = append(children, &ast.HTMLBlock{Leaf: ast.Leaf{Literal: []byte(`<section id="` + w.anchors[page] + `">`)}})
+		children = append(children, section.GetChildren()...)
+		children = append(children, &ast.HTMLBlock{Leaf: ast.Leaf{Literal: []byte(`</section>`)}})
+	}
+
+	// ast.AppendChild would drop the children of the moved nodes
+	doc := &ast.Document{}
+	for _, child := range children {
+		child.SetParent(doc)
+	}
+	doc.SetChildren(children)
+
+	// the links and embeds were rendered already, in the context of their own page
+	restore := func(content string) string {
+		content = restoreLinks(content, links, func(link string) string { return link })
+		return restoreEmbeds(content, embeds, func(embed string) string { return embed })
+	}
+	toc, body := renderDocument(doc)
+
+	// images are inlined relative to the folder of the input file
+	page := &Page{
+		Name:       start,
+		Title:      w.title(start),
+		Source:     input_file,
+		Standalone: true,
+		Backlinks:  w.backlinks[start],
+	}
+	contentStr, err := w.renderLayout(page, restore(toc), restore(body))
+	if err != nil {
+		return err
+	}
+	output, err := b.finishPage(contentStr, page)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(output_file, output)
+	if err != nil {
+		return fmt.Errorf("html write: %w", err)
+	}
+
+	b.log("Converted", len(pages), "page(s) to", output_file)
+	return nil
+}
+
+// find the pages reachable from the start page through wiki links, in the
+// order they are found, including links in embedded pages
+func (w *wiki) reachablePages(start string) []string {
+
+	pages := []string{start}
+	seen := map[string]bool{start: true}
+
+	// the pages linked from a page and the pages it embeds
+	var visit func(page string, embedded map[string]bool)
+	visit = func(page string, embedded map[string]bool) {
+		for _, target := range w.links[page] {
+			if w.pages[target] && !seen[target] {
+				seen[target] = true
+				pages = append(pages, target)
+			}
+		}
+		for _, target := range w.embeds[page] {
+			if !embedded[target] {
+				embedded[target] = true
+				visit(target, embedded)
+			}
+		}
+	}
+
+	for i := 0; i < len(pages); i++ {
+		visit(pages[i], map[string]bool{pages[i]: true})
+	}
+
+	return pages
+}
+
+// placeholderRegexp matches the link and embed placeholders, with their prefix and number
+var placeholderRegexp = regexp.MustCompile(`(mdwiembed|mdwilink)(\d+)x`)
+
+// renumber the placeholders with the given prefix, so that the placeholders of
+// several pages can be combined into one document
+func shiftPlaceholders(input []byte, prefix string, offset int) []byte {
+
+	return placeholderRegexp.ReplaceAllFunc(input, func(placeholder []byte) []byte {
+		submatches := placeholderRegexp.FindSubmatch(placeholder)
+		if string(submatches[1]) != prefix {
+			return placeholder
+		}
+		i, err := strconv.Atoi(string(submatches[2]))
+		if err != nil {
+			return placeholder
+		}
+		return []byte(prefix + strconv.Itoa(i+offset) + "x")
+	})
+}
+
+// prefix the IDs of all the headings in a document
+func prefixHeadingIDs(doc ast.Node, prefix string) {
+
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if heading, ok := node.(*ast.Heading); ok && entering {
+			heading.HeadingID = prefix + heading.HeadingID
+		}
+		return ast.GoToNext
+	})
+}
@@ -0,0 +1,87 @@
+package wiki
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// pageMeta is the metadata a page can declare in its front matter
+type pageMeta struct {
+	Title   string   `yaml:"title" toml:"title"`
+	Tags    []string `yaml:"tags" toml:"tags"`
+	Date    any      `yaml:"date" toml:"date"` // a string, or a date parsed by yaml/toml
+	Aliases []string `yaml:"aliases" toml:"aliases"`
+	Draft   bool     `yaml:"draft" toml:"draft"`
+}
+
+// get the date of the page as a string, dates without a time are formatted as 2006-01-02
+func (m pageMeta) date() string {
+
+	switch d := m.Date.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		if d.Hour() == 0 && d.Minute() == 0 && d.Second() == 0 {
+			return d.Format("2006-01-02")
+		}
+		return d.Format("2006-01-02 15:04")
+	default:
+		return fmt.Sprint(d)
+	}
+}
+
+// split the YAML (---) or TOML (+++) front matter from the markdown content,
+// content without front matter is returned unchanged, and invalid front matter
+// still returns the content after it with the error
+func splitFrontMatter(input []byte) (pageMeta, []byte, error) {
+
+	var meta pageMeta
+
+	// normalize windows line endings so the delimiters can be found
+	content := bytes.ReplaceAll(input, []byte("\r\n"), []byte("\n"))
+
+	var delimiter string
+	switch {
+	case bytes.HasPrefix(content, []byte("---\n")):
+		delimiter = "---"
+	case bytes.HasPrefix(content, []byte("+++\n")):
+		delimiter = "+++"
+	default:
+		return meta, input, nil
+	}
+
+	// find the closing delimiter on a line of its own
+	rest := content[len(delimiter)+1:]
+	end := -1
+	if bytes.HasPrefix(rest, []byte(delimiter+"\n")) || bytes.Equal(rest, []byte(delimiter)) {
+		end = 0
+	} else if i := bytes.Index(rest, []byte("\n"+delimiter+"\n")); i >= 0 {
+		end = i + 1
+	} else if bytes.HasSuffix(rest, []byte("\n"+delimiter)) {
+		end = len(rest) - len(delimiter)
+	}
+	if end < 0 {
+		// no closing delimiter, so this is just a horizontal rule
+		return meta, input, nil
+	}
+
+	block := rest[:end]
+	body := rest[end+len(delimiter):]
+	body = bytes.TrimPrefix(body, []byte("\n"))
+
+	var err error
+	if delimiter == "---" {
+		err = yaml.Unmarshal(block, &meta)
+	} else {
+		_, err = toml.Decode(string(block), &meta)
+	}
+	if err != nil {
+		return pageMeta{}, body, fmt.Errorf("invalid front matter: %w", err)
+	}
+
+	return meta, body, nil
+}
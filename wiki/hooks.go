@@ -0,0 +1,54 @@
+package wiki
+
+import (
+	"path/filepath"
+)
+
+// Page describes the page being finished by the hooks
+type Page struct {
+	Name       string   // page name relative to the wiki root, without the .md extension
+	Title      string   // title from the front matter, or the file name
+	Source     string   // path of the markdown file, empty for RenderPage
+	Root       string   // relative path from the page to the root of the site, e.g. "../"
+	Standalone bool     // the page is a self contained file, without the rest of the site
+	Backlinks  []string // names of the pages linking to the page
+}
+
+// Hook is a step finishing a page after it is put into the layout, it gets the
+// complete HTML document and returns the changed document, hooks can run for
+// several pages at the same time
+type Hook func(b *Builder, page *Page, html string) (string, error)
+
+// DefaultHooks returns the steps mdwi finishes every page with, in the order they run
+// custom hooks can be added to the list, or used to replace some of the steps
+func DefaultHooks() []Hook {
+	return []Hook{InlineImages}
+}
+
+// InlineImages replaces the images of standalone pages with data URIs, relative
+// paths are relative to the markdown file, or to SrcDir if there is none
+func InlineImages(b *Builder, page *Page, html string) (string, error) {
+
+	if !page.Standalone {
+		return html, nil
+	}
+
+	baseDir := b.SrcDir
+	if page.Source != "" {
+		baseDir = filepath.Dir(page.Source)
+	}
+	return b.inlineImages(html, baseDir), nil
+}
+
+// run the hooks of the builder on a rendered page
+func (b *Builder) finishPage(html string, page *Page) ([]byte, error) {
+
+	for _, hook := range b.Hooks {
+		var err error
+		html, err = hook(b, page, html)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []byte(html), nil
+}
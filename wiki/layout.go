@@ -0,0 +1,186 @@
+package wiki
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+)
+
+// LayoutFile is the optional template in the wiki root replacing DefaultLayout
+const LayoutFile = "_layout.html"
+
+// DefaultLayout is the html/template every page is rendered with, unless the
+// wiki has a _layout.html file, it gets a LayoutData
+const DefaultLayout = `<!DOCTYPE html>
+<html>
+<head>
+  <title>{{.Title}}{{with .SiteTitle}} - {{.}}{{end}}</title>
+  <meta charset="utf-8">
+  {{.Head}}
+</head>
+<body>
+{{- if not .Standalone}}
+<nav>
+{{- with .SiteTitle}}
+    <h3 class="site-title"><a href="{{$.Root}}index.html">{{.}}</a></h3>
+{{- end}}
+    <div class="search">
+        <input type="search" id="search" placeholder="🔍 Search" data-root="{{.Root}}">
+        <ul id="search-results"></ul>
+    </div>
+    <div class="links">
+        <ul>
+{{- range .Nav}}
+           <li><a href="{{.URL}}">{{.Title}}</a></li>
+{{- end}}
+        </ul>
+    </div>
+{{- if .Backlinks}}
+    <div class="backlinks">
+        <h4>Linked from</h4>
+        <ul>
+{{- range .Backlinks}}
+           <li><a href="{{.URL}}">{{.Title}}</a></li>
+{{- end}}
+        </ul>
+    </div>
+{{- end}}
+{{- if .TOC}}
+    <h4>Table of Contents</h4>
+{{.TOC}}
+{{- end}}
+</nav>
+{{- else if .TOC}}
+<nav>
+{{.TOC}}
+</nav>
+{{- end}}
+<main>
+{{.Body -}}
+</main>
+<footer>
+{{- if .Footer}}
+    {{.Footer}}
+{{- else}}
+    <p>generated by <a href="https://github.com/maciakl/mdwi">mdwi</a> <small>{{.Version}}</small></p>
+{{- end}}
+</footer>
+</body>
+</html>
+`
+
+// LayoutData is what the layout template gets to render a page
+type LayoutData struct {
+	Name       string        // page name relative to the wiki root, without the .md extension
+	Title      string        // title of the page
+	SiteTitle  string        // title of the site from the config file, may be empty
+	Root       string        // relative path from the page to the root of the site, e.g. "../"
+	Standalone bool          // the page is a self contained file, without the rest of the site
+	Head       template.HTML // the stylesheet, favicon and scripts of the page
+	Nav        []NavLink     // links at the top of the sidebar, relative to the page
+	Backlinks  []NavLink     // pages linking to the page
+	TOC        template.HTML // table of contents generated from the headings, may be empty
+	Body       template.HTML // the rendered markdown
+	Footer     template.HTML // footer from the config file, empty for the default one
+	Version    string        // version of mdwi
+}
+
+// parse the layout of the wiki, _layout.html in the wiki root or the default one
+func (b *Builder) loadLayout() error {
+
+	source := DefaultLayout
+	name := "default layout"
+
+	input, err := os.ReadFile(b.srcPath(LayoutFile))
+	if err == nil {
+		source = string(input)
+		name = LayoutFile
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("layout: %w", err)
+	}
+
+	layout, err := template.New(name).Parse(source)
+	if err != nil {
+		return fmt.Errorf("layout: %w", err)
+	}
+	b.layout = layout
+	b.layoutSource = source
+	return nil
+}
+
+// render a parsed page as the table of contents and the HTML of its content
+func renderDocument(doc ast.Node) (toc string, body string) {
+
+	// the table of contents is written by the renderer in a <nav> of its own,
+	// before the content, the layout decides where it goes
+	var buf bytes.Buffer
+	html.NewRenderer(html.RendererOptions{Flags: html.CommonFlags | html.TOC}).RenderHeader(&buf, doc)
+	toc = strings.TrimSuffix(strings.TrimPrefix(buf.String(), "<nav>\n"), "\n\n</nav>\n")
+
+	body = string(markdown.Render(doc, html.NewRenderer(html.RendererOptions{Flags: html.CommonFlags})))
+
+	return toc, body
+}
+
+// put the rendered content of a page into the layout
+func (w *wiki) renderLayout(page *Page, toc string, body string) (string, error) {
+
+	data := LayoutData{
+		Name:       page.Name,
+		Title:      page.Title,
+		SiteTitle:  w.Config.Title,
+		Root:       page.Root,
+		Standalone: page.Standalone,
+		Head:       template.HTML(w.pageHead(page)),
+		TOC:        template.HTML(toc),
+		Body:       template.HTML(body),
+		Footer:     template.HTML(w.Config.Footer),
+		Version:    Version,
+	}
+
+	for _, link := range w.Config.navLinks() {
+		data.Nav = append(data.Nav, NavLink{Title: link.Title, URL: linkURL(link.URL, page.Root)})
+	}
+	for _, name := range page.Backlinks {
+		data.Backlinks = append(data.Backlinks, NavLink{Title: w.title(name), URL: page.Root + pageURL(name)})
+	}
+
+	var buf bytes.Buffer
+	err := w.layout.Execute(&buf, data)
+	if err != nil {
+		return "", fmt.Errorf("layout: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// the stylesheet, favicon and scripts for the <head> of a page, standalone
+// pages get the stylesheet and favicon inline and don't need the search
+func (b *Builder) pageHead(page *Page) string {
+
+	var head []string
+
+	if page.Standalone {
+		head = append(head,
+			`<style>`+b.Config.stylesheetString()+`</style>`,
+			`<link rel="icon" href="`+b.Config.faviconDataURI()+`">`)
+	} else {
+		head = append(head,
+			`<link rel="stylesheet" href="`+page.Root+`style.css">`,
+			`<link rel="icon" href="`+page.Root+b.Config.faviconName()+`" type="`+b.Config.faviconMIME()+`">`,
+			`<script src="`+page.Root+`search_index.js" defer></script>`,
+			`<script src="`+page.Root+`search.js" defer></script>`)
+	}
+
+	// reload the page whenever the preview server reports a rebuild
+	if b.LiveReload {
+		head = append(head, `<script>new EventSource("`+reloadPath+`").onmessage = function() { location.reload(); };</script>`)
+	}
+
+	return strings.Join(head, "\n  ")
+}
@@ -0,0 +1,242 @@
+package wiki
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ManifestFile is the file in the output directory listing the files written by
+// the last build, so that the next build only removes files mdwi generated
+const ManifestFile = ".mdwi-manifest.json"
+
+// StaticDirs are the folders in the root of the wiki whose contents are copied
+// into the output directory as they are, e.g. static/robots.txt goes to
+// _site/robots.txt
+var StaticDirs = []string{"static", "_static"}
+
+// manifest is the contents of the manifest file
+type manifest struct {
+	Version string   `json:"version"` // version of mdwi that wrote the files
+	Files   []string `json:"files"`   // paths relative to the output directory
+}
+
+// create the output directory if it doesn't exist and start recording the files
+// written to it, a clean build first removes the files of the previous build,
+// files mdwi didn't generate are never touched
+func (b *Builder) openSite() error {
+
+	err := os.MkdirAll(b.OutDir, 0755)
+	if err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+
+	previous, err := b.readManifest()
+	if err != nil {
+		return err
+	}
+
+	b.previous = previous
+	b.generated = make(map[string]bool)
+
+	if b.Clean {
+		b.log("Removing the files of the previous build")
+		b.removeGenerated(previous)
+		b.previous = nil
+	}
+
+	b.loadCache()
+	return nil
+}
+
+// remove the files of the previous build that were not written again, and
+// write the manifest of this build
+func (b *Builder) closeSite() error {
+
+	var stale []string
+	for _, file := range b.previous {
+		if !b.generated[file] {
+			stale = append(stale, file)
+		}
+	}
+	b.removeGenerated(stale)
+	b.previous = nil
+
+	return b.writeManifest()
+}
+
+// read the list of files written by the previous build, empty if there is no manifest
+func (b *Builder) readManifest() ([]string, error) {
+
+	data, err := os.ReadFile(filepath.Join(b.OutDir, ManifestFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("manifest read: %w", err)
+	}
+
+	var m manifest
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", filepath.Join(b.OutDir, ManifestFile), err)
+	}
+
+	// never let the manifest point outside the output directory
+	var files []string
+	for _, file := range m.Files {
+		if filepath.IsLocal(filepath.FromSlash(file)) && file != ManifestFile {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// write the list of files generated by the current build
+func (b *Builder) writeManifest() error {
+
+	m := manifest{Version: Version, Files: []string{}}
+	for file := range b.generated {
+		m.Files = append(m.Files, file)
+	}
+	sort.Strings(m.Files)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+	err = writeFileAtomic(filepath.Join(b.OutDir, ManifestFile), data)
+	if err != nil {
+		return fmt.Errorf("manifest write: %w", err)
+	}
+	return nil
+}
+
+// remember that a file in the output directory was generated by the build
+func (b *Builder) record(path string) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.generated == nil {
+		return // not building the site, e.g. a standalone file
+	}
+	rel, err := filepath.Rel(b.OutDir, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return
+	}
+	b.generated[filepath.ToSlash(rel)] = true
+}
+
+// forget a generated file that was removed from the output directory
+func (b *Builder) unrecord(path string) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.generated == nil {
+		return
+	}
+	rel, err := filepath.Rel(b.OutDir, path)
+	if err == nil {
+		delete(b.generated, filepath.ToSlash(rel))
+	}
+}
+
+// remove generated files from the output directory, along with the folders
+// they leave empty
+func (b *Builder) removeGenerated(files []string) {
+
+	for _, file := range files {
+		path := filepath.Join(b.OutDir, filepath.FromSlash(file))
+		err := os.Remove(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				b.warn("Error (remove):", err)
+			}
+			continue
+		}
+		b.log("Removed", path)
+
+		// os.Remove fails on folders that still have files in them
+		for dir := filepath.Dir(file); dir != "."; dir = filepath.Dir(dir) {
+			if os.Remove(filepath.Join(b.OutDir, dir)) != nil {
+				break
+			}
+		}
+	}
+}
+
+// check if a path relative to the source directory is in one of the static folders
+func staticFile(file string) bool {
+	first, _, ok := strings.Cut(filepath.ToSlash(file), "/")
+	return ok && slices.Contains(StaticDirs, first)
+}
+
+// the path a source file is copied to, the files in the static folders go to
+// the root of the output directory
+func (b *Builder) copyPath(file string) string {
+	if staticFile(file) {
+		_, rest, _ := strings.Cut(filepath.ToSlash(file), "/")
+		return filepath.Join(b.OutDir, filepath.FromSlash(rest))
+	}
+	return filepath.Join(b.OutDir, file)
+}
+
+// find the files in the static folders, the paths are relative to the source directory
+func (b *Builder) staticFiles() ([]string, error) {
+
+	var files []string
+	for _, dir := range StaticDirs {
+		root := b.srcPath(dir)
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			continue
+		}
+
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(b.SrcDir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, rel)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// copy the contents of the static folders into the output directory, after
+// everything else so that they can replace generated files like style.css, the
+// files that can't be copied are added to w.failed
+func (w *wiki) copyStatic() error {
+
+	files, err := w.staticFiles()
+	if err != nil {
+		return fmt.Errorf("static find: %w", err)
+	}
+
+	for _, file := range files {
+		dst := w.copyPath(file)
+		err := copyFileAtomic(w.srcPath(file), dst)
+		if err != nil {
+			w.copyFailed(file, dst, fmt.Errorf("static copy: %w", err))
+			continue
+		}
+		w.record(dst)
+		w.log("Copied", file, "to", dst)
+	}
+	return nil
+}
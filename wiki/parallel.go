@@ -0,0 +1,86 @@
+package wiki
+
+import (
+	"runtime"
+)
+
+// message is a progress message or warning of a page rendered in parallel
+type message struct {
+	warn bool
+	args []any
+}
+
+// messages collects the messages of a page while it is rendered, so that they
+// can be printed in the order of the pages instead of the order they finish in
+type messages []message
+
+// the number of pages rendered at the same time
+func (b *Builder) jobs() int {
+	if b.Jobs > 0 {
+		return b.Jobs
+	}
+	return runtime.NumCPU()
+}
+
+// print a progress message, or keep it for later while rendering in parallel
+func (w *wiki) log(a ...any) {
+	if w.messages != nil {
+		*w.messages = append(*w.messages, message{args: a})
+		return
+	}
+	w.Builder.log(a...)
+}
+
+// print a warning, or keep it for later while rendering in parallel
+func (w *wiki) warn(a ...any) {
+	if w.messages != nil {
+		*w.messages = append(*w.messages, message{warn: true, args: a})
+		return
+	}
+	w.Builder.warn(a...)
+}
+
+// render the given markdown files with up to Jobs pages at the same time, the
+// messages of every page are printed in the order of the files, and so are the
+// errors returned, which are nil for the pages that were rendered
+func (w *wiki) renderPages(files []string) []error {
+
+	errs := make([]error, len(files))
+	logs := make([]messages, len(files))
+	done := make([]chan struct{}, len(files))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	queue := make(chan int)
+	go func() {
+		for i := range files {
+			queue <- i
+		}
+		close(queue)
+	}()
+
+	for n := 0; n < min(w.jobs(), len(files)); n++ {
+		go func() {
+			for i := range queue {
+				// the pages only read the wiki, each one gets its own messages
+				page := *w
+				page.messages = &logs[i]
+				errs[i] = page.renderPage(files[i])
+				close(done[i])
+			}
+		}()
+	}
+
+	for i := range files {
+		<-done[i]
+		for _, msg := range logs[i] {
+			if msg.warn {
+				w.Builder.warn(msg.args...)
+			} else {
+				w.Builder.log(msg.args...)
+			}
+		}
+	}
+	return errs
+}
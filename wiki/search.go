@@ -0,0 +1,204 @@
+package wiki
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// searchEntry is a single page in the search index
+type searchEntry struct {
+	Title    string          `json:"title"`
+	URL      string          `json:"url"`
+	Headings []searchHeading `json:"headings"`
+	Body     string          `json:"body"`
+}
+
+// searchHeading is a heading of a page in the search index, so that results
+// can link straight to the matching section
+type searchHeading struct {
+	Text string `json:"text"`
+	ID   string `json:"id"`
+}
+
+// build the search index entry for a single markdown file
+func (w *wiki) searchEntry(file string) (searchEntry, error) {
+
+	input, err := os.ReadFile(w.srcPath(file))
+	if err != nil {
+		return searchEntry{}, err
+	}
+
+	// invalid front matter is in w.failed, the page is found by its text
+	meta, input, _ := splitFrontMatter(input)
+
+	name := pageName(file)
+	entry := searchEntry{
+		Title:    meta.Title,
+		URL:      pageURL(name),
+		Headings: []searchHeading{},
+	}
+
+	var body strings.Builder
+
+	// parse the page the same way markdownFile does, so the heading IDs match,
+	// and use the link labels as the text of the wiki links
+	input, links := protectLinks(input)
+	labels := func(text string) string {
+		return restoreLinks(text, links, func(link string) string {
+			_, _, label := splitLink(link)
+			return label
+		})
+	}
+
+	ast.WalkFunc(w.parseMarkdown(input), func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+
+		switch n := node.(type) {
+		case *ast.Heading:
+			text := labels(nodeText(n))
+			entry.Headings = append(entry.Headings, searchHeading{Text: text, ID: n.HeadingID})
+			if entry.Title == "" && n.Level == 1 {
+				entry.Title = text
+			}
+			return ast.SkipChildren
+		case *ast.Text, *ast.Code, *ast.CodeBlock:
+			body.WriteString(labels(string(node.AsLeaf().Literal)))
+			body.WriteString(" ")
+		}
+		return ast.GoToNext
+	})
+
+	if entry.Title == "" {
+		entry.Title = name
+	}
+	entry.Body = strings.Join(strings.Fields(body.String()), " ")
+
+	return entry, nil
+}
+
+// get the plain text of a node and all its children
+func nodeText(node ast.Node) string {
+
+	var text strings.Builder
+
+	ast.WalkFunc(node, func(n ast.Node, entering bool) ast.WalkStatus {
+		if leaf := n.AsLeaf(); entering && leaf != nil {
+			text.Write(leaf.Literal)
+		}
+		return ast.GoToNext
+	})
+
+	return strings.TrimSpace(text.String())
+}
+
+// write the search index of all the pages to _site as search.json, and as
+// search_index.js so that it can be loaded from disk without a server
+func (w *wiki) writeSearchIndex() error {
+
+	entries := []searchEntry{}
+	for _, file := range w.files {
+		entry, err := w.searchEntry(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(filepath.Join(w.OutDir, "search.json"), data)
+	if err != nil {
+		return err
+	}
+
+	script := "window.mdwiSearchIndex = " + string(data) + ";\n"
+	err = writeFileAtomic(filepath.Join(w.OutDir, "search_index.js"), []byte(script))
+	if err != nil {
+		return err
+	}
+
+	w.record(filepath.Join(w.OutDir, "search.json"))
+	w.record(filepath.Join(w.OutDir, "search_index.js"))
+	w.log("Created", filepath.Join(w.OutDir, "search.json"), "and", filepath.Join(w.OutDir, "search_index.js"))
+	return nil
+}
+
+// generate the script running the search box in the sidebar
+func generateSearchScript() string {
+	// create the search script
+	script := `
+(function () {
+    var input = document.getElementById("search");
+    var results = document.getElementById("search-results");
+    if (!input || !results) {
+        return;
+    }
+    var root = input.getAttribute("data-root") || "";
+
+    function contains(text, term) {
+        return text.toLowerCase().indexOf(term) !== -1;
+    }
+
+    function search(query) {
+        var terms = query.toLowerCase().split(/\s+/).filter(function (t) { return t.length > 0; });
+        var found = [];
+        if (terms.length === 0 || !window.mdwiSearchIndex) {
+            return found;
+        }
+        window.mdwiSearchIndex.forEach(function (page) {
+            var score = 0;
+            var anchor = "";
+            var matchedAll = terms.every(function (term) {
+                var matched = false;
+                if (contains(page.title, term)) {
+                    score += 10;
+                    matched = true;
+                }
+                page.headings.forEach(function (heading) {
+                    if (contains(heading.text, term)) {
+                        score += 5;
+                        matched = true;
+                        if (!anchor) {
+                            anchor = heading.id;
+                        }
+                    }
+                });
+                if (contains(page.body, term)) {
+                    score += 1;
+                    matched = true;
+                }
+                return matched;
+            });
+            if (matchedAll) {
+                found.push({ page: page, score: score, anchor: anchor });
+            }
+        });
+        found.sort(function (a, b) { return b.score - a.score; });
+        return found.slice(0, 10);
+    }
+
+    input.addEventListener("input", function () {
+        results.innerHTML = "";
+        search(input.value).forEach(function (result) {
+            var link = document.createElement("a");
+            link.href = root + result.page.url + (result.anchor ? "#" + result.anchor : "");
+            link.textContent = result.page.title;
+            var item = document.createElement("li");
+            item.appendChild(link);
+            results.appendChild(item);
+        });
+    });
+})();
+`
+	return script
+}
@@ -0,0 +1,105 @@
+package wiki
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// DefaultPort is the port used by the preview server when none is given
+const DefaultPort = "8000"
+
+// the path of the server sent events stream used for live reload
+const reloadPath = "/_mdwi/reload"
+
+// reloader keeps track of the browsers waiting for a live reload signal
+type reloader struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+// Serve builds the wiki with LiveReload turned on, serves OutDir on localhost
+// and rebuilds it whenever the source files change, telling the open browsers
+// to reload, it only returns if the first build or the server fails
+func (b *Builder) Serve(port string) error {
+
+	b.LiveReload = true
+
+	w, err := b.initialBuild()
+	if err != nil {
+		return err
+	}
+
+	r := &reloader{clients: make(map[chan struct{}]bool)}
+
+	mux := http.NewServeMux()
+	mux.Handle(reloadPath, r)
+	mux.Handle("/", http.FileServer(http.Dir(b.OutDir)))
+
+	addr := "localhost:" + port
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("serve: %w", err)
+	}
+
+	stop := make(chan error, 1)
+	go func() {
+		stop <- fmt.Errorf("serve: %w", http.Serve(listener, mux))
+	}()
+
+	b.log("Serving wiki at http://" + addr + "/")
+
+	return w.watchChanges(r.reload, stop)
+}
+
+// stream a reload event to the browser every time the wiki is rebuilt
+func (r *reloader) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ch := make(chan struct{}, 1)
+	r.mu.Lock()
+	r.clients[ch] = true
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.clients, ch)
+		r.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ch:
+			fmt.Fprint(rw, "data: reload\n\n")
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// tell all the connected browsers to reload
+func (r *reloader) reload() {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for ch := range r.clients {
+		select {
+		case ch <- struct{}{}:
+		default: // a reload is already pending for this browser
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package wiki
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the directory a build is written to before it replaces the output directory,
+// next to the output directory so that it can be renamed over it
+func stagingDir(out string) string {
+	return filepath.Join(filepath.Dir(out), "."+filepath.Base(out)+".staging")
+}
+
+// the directory the previous site is moved to while the staging directory is
+// renamed over the output directory, on systems that can't swap them in one step
+func previousDir(out string) string {
+	return filepath.Join(filepath.Dir(out), "."+filepath.Base(out)+".old")
+}
+
+// start writing the build to a staging directory, a copy of the current output
+// directory so that the files of the previous build and the files mdwi didn't
+// generate are kept, OutDir points at the staging directory until swapSite
+func (b *Builder) stageSite() error {
+
+	staging := stagingDir(b.OutDir)
+
+	// a build that was stopped between the two renames of swapSite leaves the
+	// previous site next to the output directory
+	if _, err := os.Stat(b.OutDir); os.IsNotExist(err) {
+		if _, err := os.Stat(previousDir(b.OutDir)); err == nil {
+			err = os.Rename(previousDir(b.OutDir), b.OutDir)
+			if err != nil {
+				return fmt.Errorf("restore: %w", err)
+			}
+			b.warn("Warning: restored", b.OutDir, "from an interrupted build")
+		}
+	}
+
+	// a staging directory left behind by a build that didn't finish, e.g. because
+	// it was interrupted with Ctrl-C
+	err := os.RemoveAll(staging)
+	if err != nil {
+		return fmt.Errorf("staging remove: %w", err)
+	}
+
+	if _, err := os.Stat(b.OutDir); err == nil {
+		err = linkTree(b.OutDir, staging)
+		if err != nil {
+			_ = os.RemoveAll(staging)
+			return fmt.Errorf("staging: %w", err)
+		}
+	}
+
+	b.target = b.OutDir
+	b.OutDir = staging
+	return nil
+}
+
+// replace the output directory with the finished staging directory, so that
+// anything reading the output directory sees either the previous site or the
+// new one, never a mix of the two or a missing directory
+func (b *Builder) swapSite() error {
+
+	staging, out := b.OutDir, b.target
+	b.OutDir, b.target = out, ""
+
+	// the first build just renames the staging directory, which is atomic
+	if _, err := os.Stat(out); os.IsNotExist(err) {
+		err = os.Rename(staging, out)
+		if err != nil {
+			_ = os.RemoveAll(staging)
+			return fmt.Errorf("swap: %w", err)
+		}
+		return nil
+	}
+
+	// swap the two directories in one step, the staging directory then holds
+	// the previous site
+	err := exchangeDirs(staging, out)
+	if err == nil {
+		_ = os.RemoveAll(staging)
+		return nil
+	}
+	if !errors.Is(err, errors.ErrUnsupported) {
+		_ = os.RemoveAll(staging)
+		return fmt.Errorf("swap: %w", err)
+	}
+
+	// otherwise move the previous site out of the way first, leaving a short
+	// moment without an output directory, stageSite recovers from a build
+	// stopped in between
+	old := previousDir(out)
+	_ = os.RemoveAll(old)
+
+	err = os.Rename(out, old)
+	if err != nil {
+		_ = os.RemoveAll(staging)
+		return fmt.Errorf("swap: %w", err)
+	}
+
+	err = os.Rename(staging, out)
+	if err != nil {
+		_ = os.Rename(old, out) // put the previous site back
+		_ = os.RemoveAll(staging)
+		return fmt.Errorf("swap: %w", err)
+	}
+
+	_ = os.RemoveAll(old)
+	return nil
+}
+
+// throw the staging directory away if the build didn't get to swapSite,
+// leaving the output directory as it was
+func (b *Builder) unstageSite() {
+
+	if b.target == "" {
+		return
+	}
+	staging := b.OutDir
+	b.OutDir, b.target = b.target, ""
+	_ = os.RemoveAll(staging)
+}
+
+// recreate the folders of src in dst with hard links to its files, which is
+// much faster than copying them, files that can't be linked, e.g. because dst is
+// on another file system, are copied
+// the build never writes to the linked files in place, it replaces them with
+// writeFileAtomic and copyFileAtomic, so the files in src are left as they are
+func linkTree(src string, dst string) error {
+
+	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case d.IsDir():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return os.MkdirAll(target, info.Mode().Perm())
+		case d.Type()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			if os.Link(path, target) == nil {
+				return nil
+			}
+			return copyFileAtomic(path, target)
+		}
+		return nil // sockets and the like are not part of a site
+	})
+}
+
+// write a file by writing a temporary file next to it and renaming it over the
+// file, so that a server never sees a partly written file
+func writeFileAtomic(path string, data []byte) error {
+	return replaceFile(path, 0644, func(f *os.File) error {
+		_, err := f.Write(data)
+		return err
+	})
+}
+
+// copy a file the same way writeFileAtomic writes one, keeping its permissions,
+// the folder of dst is created if needed
+func copyFileAtomic(src string, dst string) error {
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+
+	return replaceFile(dst, info.Mode().Perm(), func(f *os.File) error {
+		_, err := io.Copy(f, in)
+		return err
+	})
+}
+
+// create a temporary file next to path, fill it with write and rename it over path
+func replaceFile(path string, perm os.FileMode, write func(*os.File) error) error {
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // only left if something failed
+
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// show the paths in the staging directory as the paths they will have in the
+// output directory
+func (b *Builder) displayPaths(a []any) []any {
+
+	if b.target == "" {
+		return a
+	}
+	shown := make([]any, len(a))
+	for i, arg := range a {
+		if s, ok := arg.(string); ok && strings.HasPrefix(s, b.OutDir) {
+			arg = b.target + strings.TrimPrefix(s, b.OutDir)
+		}
+		shown[i] = arg
+	}
+	return shown
+}
@@ -0,0 +1,20 @@
+//go:build linux
+
+package wiki
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// swap two directories in one step, so that there is no moment when one of
+// them is missing, not every filesystem supports it
+func exchangeDirs(a string, b string) error {
+
+	err := unix.Renameat2(unix.AT_FDCWD, a, unix.AT_FDCWD, b, unix.RENAME_EXCHANGE)
+	if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EINVAL) {
+		return errors.ErrUnsupported
+	}
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package wiki
+
+import "errors"
+
+// swapping directories in one step is only supported on linux
+func exchangeDirs(a string, b string) error {
+	return errors.ErrUnsupported
+}
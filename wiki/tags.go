@@ -0,0 +1,167 @@
+package wiki
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// inlineTagPattern matches inline tags such as #golang in the text of a page
+const inlineTagPattern = `(^|\s|\()#(\p{L}[\p{L}\p{N}_-]*)`
+
+var inlineTagRegexp = regexp.MustCompile(inlineTagPattern)
+
+// normalize a tag name so that #Go, #go and "go" in the front matter are the same tag
+func normalizeTag(tag string) string {
+	tag = strings.ReplaceAll(strings.TrimPrefix(tag, "#"), "/", " ")
+	return strings.ToLower(strings.Join(strings.Fields(tag), "-"))
+}
+
+// the page name of the generated page listing all the pages with the tag
+func tagPage(tag string) string {
+	return "tag-" + tag
+}
+
+// find the inline tags in the text of a parsed page, leaving out code and links
+func inlineTags(doc ast.Node) []string {
+
+	var tags []string
+	for _, text := range tagTextNodes(doc) {
+		for _, match := range inlineTagRegexp.FindAllStringSubmatch(string(text.Literal), -1) {
+			tags = append(tags, normalizeTag(match[2]))
+		}
+	}
+	return tags
+}
+
+// find the text nodes that can contain inline tags
+func tagTextNodes(doc ast.Node) []*ast.Text {
+
+	var nodes []*ast.Text
+
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.Link, *ast.Image:
+			return ast.SkipChildren
+		case *ast.Text:
+			nodes = append(nodes, n)
+		}
+		return ast.GoToNext
+	})
+
+	return nodes
+}
+
+// turn the inline tags of a parsed page into links to their tag pages
+func linkInlineTags(doc ast.Node, root string) {
+
+	for _, text := range tagTextNodes(doc) {
+
+		literal := string(text.Literal)
+		matches := inlineTagRegexp.FindAllStringSubmatchIndex(literal, -1)
+		if len(matches) == 0 {
+			continue
+		}
+
+		// split the text node into text before, between and after the tags
+		var replacement []ast.Node
+		last := 0
+		for _, m := range matches {
+			start, end := m[4]-1, m[5] // include the # in front of the tag name
+			if start > last {
+				replacement = append(replacement, &ast.Text{Leaf: ast.Leaf{Literal: []byte(literal[last:start])}})
+			}
+			link := &ast.Link{
+				Destination:          []byte(root + pageURL(tagPage(normalizeTag(literal[m[4]:m[5]])))),
+				AdditionalAttributes: []string{`class="tag"`},
+			}
+			ast.AppendChild(link, &ast.Text{Leaf: ast.Leaf{Literal: []byte(literal[start:end])}})
+			replacement = append(replacement, link)
+			last = end
+		}
+		if last < len(literal) {
+			replacement = append(replacement, &ast.Text{Leaf: ast.Leaf{Literal: []byte(literal[last:])}})
+		}
+
+		// swap the original text node for the new nodes
+		parent := text.GetParent()
+		var children []ast.Node
+		for _, child := range parent.GetChildren() {
+			if child != ast.Node(text) {
+				children = append(children, child)
+				continue
+			}
+			for _, node := range replacement {
+				node.SetParent(parent)
+				children = append(children, node)
+			}
+		}
+		parent.SetChildren(children)
+	}
+}
+
+// get all the tags of the wiki in alphabetical order
+func (w *wiki) tagNames() []string {
+
+	var names []string
+	for tag := range w.tags {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// generate the markdown for the overview of all tags
+func (w *wiki) generateTagIndex() string {
+
+	var tags_builder strings.Builder
+
+	tags_builder.WriteString("---\ntitle: Tags\n---\n")
+	tags_builder.WriteString("# Tags\n\n")
+
+	for _, tag := range w.tagNames() {
+		fmt.Fprintf(&tags_builder, "- [%s](%s) (%d)\n", escapeMarkdown(tag), pageURL(tagPage(tag)), len(w.tags[tag]))
+	}
+
+	return tags_builder.String()
+}
+
+// generate the markdown for the list of pages with the given tag
+func (w *wiki) generateTagList(tag string) string {
+
+	var tag_builder strings.Builder
+
+	fmt.Fprintf(&tag_builder, "---\ntitle: %q\n---\n", "Tag: "+tag)
+	fmt.Fprintf(&tag_builder, "# Tag: %s\n\n", escapeMarkdown(tag))
+
+	for _, name := range w.tags[tag] {
+		tag_builder.WriteString(w.listEntry(name))
+	}
+
+	return tag_builder.String()
+}
+
+// generate the tag overview and one page per tag, and convert them to HTML
+// in the _site directory
+func (w *wiki) renderTags() error {
+
+	err := w.generatedPage("tags", w.generateTagIndex())
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range w.tagNames() {
+		err := w.generatedPage(tagPage(tag), w.generateTagList(tag))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package wiki
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultTheme is the theme used when the config doesn't choose one
+const DefaultTheme = "light"
+
+// themes maps the names of the built in themes to the CSS variables with their
+// colors, used by the default stylesheet
+var themes = map[string]string{
+	"light": `
+	color-scheme: light;
+	--background: #fefefe;
+	--text: #000000;
+	--heading: #000000;
+	--border: gray;
+	--border-light: #CCCCCC;
+	--muted: #777777;
+	--link: #4183C4;
+	--accent: #088A85;
+	--error: #AA0000;
+	--code-background: #F8F8F8;
+	--code-border: #EAEAEA;
+	--input-border: #bbb;
+	--input-background: #ffffff;
+	--button-background: #eee;`,
+
+	"dark": `
+	color-scheme: dark;
+	--background: #1e1f22;
+	--text: #dcdcdc;
+	--heading: #f0f0f0;
+	--border: #777777;
+	--border-light: #44474d;
+	--muted: #9a9a9a;
+	--link: #6cb6ff;
+	--accent: #4fc1bb;
+	--error: #ff6b6b;
+	--code-background: #2b2d31;
+	--code-border: #3a3d42;
+	--input-border: #555555;
+	--input-background: #2b2d31;
+	--button-background: #3a3d42;`,
+
+	"sepia": `
+	color-scheme: light;
+	--background: #f4ecd8;
+	--text: #433422;
+	--heading: #3b2a1a;
+	--border: #a08c6c;
+	--border-light: #d8c8a8;
+	--muted: #7a6a55;
+	--link: #8a4b0f;
+	--accent: #6b7f3a;
+	--error: #a8321c;
+	--code-background: #ebe0c8;
+	--code-border: #d8c8a8;
+	--input-border: #b8a88a;
+	--input-background: #fbf6ea;
+	--button-background: #e8dcc0;`,
+}
+
+// Themes returns the names of the built in themes, including auto which follows the
+// light or dark preference of the browser
+func Themes() []string {
+
+	names := []string{"auto"}
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// the CSS setting the colors of a theme, auto uses the light colors and
+// switches to the dark ones when the browser prefers a dark color scheme
+func themeStylesheet(theme string) string {
+
+	if theme == "auto" {
+		return ":root {" + strings.Replace(themes["light"], "color-scheme: light;", "color-scheme: light dark;", 1) + "\n}\n\n" +
+			"@media (prefers-color-scheme: dark) {\n:root {" + themes["dark"] + "\n}\n}"
+	}
+
+	colors, ok := themes[theme]
+	if !ok {
+		colors = themes[DefaultTheme]
+	}
+	return ":root {" + colors + "\n}"
+}
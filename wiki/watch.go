@@ -0,0 +1,413 @@
+package wiki
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// how often the source files are checked for changes
+const watchInterval = 500 * time.Millisecond
+
+// how long the source files have to stay unchanged before a rebuild starts
+const watchDebounce = 300 * time.Millisecond
+
+// fileState is what we remember about a source file between checks
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// snapshot maps the paths of all the watched source files to their state
+type snapshot map[string]fileState
+
+// Watch builds the wiki once, then keeps rebuilding the affected pages whenever
+// the markdown or image files change, it only returns if the first build fails
+func (b *Builder) Watch() error {
+
+	w, err := b.initialBuild()
+	if err != nil {
+		return err
+	}
+	return w.watchChanges(nil, nil)
+}
+
+// build the whole wiki, reporting failing pages instead of stopping
+func (b *Builder) initialBuild() (*wiki, error) {
+
+	err := b.init()
+	if err != nil {
+		return nil, err
+	}
+
+	b.log("Generating wiki using mdwi version", Version, "...")
+
+	// the first build is staged like Build, the rebuilds replace single files
+	err = b.stageSite()
+	if err != nil {
+		return nil, err
+	}
+	defer b.unstageSite()
+
+	err = b.prepareSite()
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := b.loadWiki()
+	if err != nil {
+		return nil, err
+	}
+	w.renderAll(w.renderFiles(), true)
+	w.copyAssets()
+	err = w.copyStatic()
+	if err != nil {
+		b.warn("Error:", err)
+	}
+	w.reportFailed()
+	err = b.closeSite()
+	if err != nil {
+		b.warn("Error:", err)
+	}
+	w.reportBroken()
+	w.reportEmbeds()
+	w.reportUnused()
+
+	err = b.swapSite()
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// watch the source files and rebuild the affected pages when they change,
+// calling onRebuild (if not nil) after each rebuild, until an error is
+// received from stop
+func (w *wiki) watchChanges(onRebuild func(), stop <-chan error) error {
+
+	last := w.takeSnapshot()
+
+	w.log("Watching for changes, press Ctrl+C to stop...")
+
+	for {
+		select {
+		case err := <-stop:
+			return err
+		case <-time.After(watchInterval):
+		}
+
+		current := w.takeSnapshot()
+		if sameSnapshot(last, current) {
+			continue
+		}
+
+		// wait for a burst of saves to settle down before rebuilding
+		for {
+			time.Sleep(watchDebounce)
+			next := w.takeSnapshot()
+			if sameSnapshot(current, next) {
+				break
+			}
+			current = next
+		}
+
+		w = w.rebuild(last, current)
+		last = current
+
+		if onRebuild != nil {
+			onRebuild()
+		}
+	}
+}
+
+// record the state of all the markdown, asset and static files, and of the
+// other files the pages of the wiki link to
+func (w *wiki) takeSnapshot() snapshot {
+
+	snap := make(snapshot)
+
+	add := func(files []string, err error) {
+		if err != nil {
+			w.warn("Error (watch):", err)
+			return
+		}
+		for _, file := range files {
+			info, err := os.Stat(w.srcPath(file))
+			if err != nil {
+				continue // the file was removed while we were looking
+			}
+			snap[file] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+
+	add(w.findFiles("*.md"))
+	add(w.listAssets())
+	add(w.staticFiles())
+	for file := range w.assets {
+		add([]string{file}, nil)
+	}
+
+	// the layout of all the pages
+	if info, err := os.Stat(w.srcPath(LayoutFile)); err == nil {
+		snap[LayoutFile] = fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	return snap
+}
+
+func sameSnapshot(a, b snapshot) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+	for file, state := range a {
+		other, ok := b[file]
+		if !ok || !state.modTime.Equal(other.modTime) || state.size != other.size {
+			return false
+		}
+	}
+	return true
+}
+
+// compare two snapshots, returning the files that were added or modified and
+// the files that were removed
+func diffSnapshots(before, after snapshot) (changed []string, removed []string) {
+
+	for file, state := range after {
+		old, ok := before[file]
+		if !ok || !state.modTime.Equal(old.modTime) || state.size != old.size {
+			changed = append(changed, file)
+		}
+	}
+	for file := range before {
+		if _, ok := after[file]; !ok {
+			removed = append(removed, file)
+		}
+	}
+
+	slices.Sort(changed)
+	slices.Sort(removed)
+	return changed, removed
+}
+
+// re-render the pages affected by the changes between the two snapshots and
+// return the updated wiki, on failure the old wiki is kept
+func (old *wiki) rebuild(before, after snapshot) *wiki {
+
+	changed, removed := diffSnapshots(before, after)
+
+	// a page that can't be read, e.g. while its front matter is being edited,
+	// keeps the old wiki until it is fixed
+	w, err := old.loadWiki()
+	if err == nil && len(w.failed) > 0 {
+		err = &BuildError{Failed: w.failed}
+	}
+	if err != nil {
+		old.warn("Error:", err)
+		return old
+	}
+
+	affected := make(map[string]bool) // names of the pages to re-render
+	listChanged := false
+
+	// pages linking to a page that was added or removed need their links updated
+	markLinking := func(name string) {
+		for _, page := range old.backlinks[name] {
+			affected[page] = true
+		}
+		for _, page := range w.backlinks[name] {
+			affected[page] = true
+		}
+	}
+
+	layoutChanged := false
+
+	for _, file := range changed {
+		if file == LayoutFile {
+			layoutChanged = true
+			continue
+		}
+		if staticFile(file) || !strings.HasSuffix(file, ".md") {
+			w.copyFile(file)
+			continue
+		}
+		affected[pageName(file)] = true
+	}
+
+	for _, file := range removed {
+		if file == LayoutFile {
+			layoutChanged = true
+			continue
+		}
+		if staticFile(file) || !strings.HasSuffix(file, ".md") {
+			w.removeOutput(w.copyPath(file))
+		}
+	}
+
+	// every page uses the layout, a broken layout keeps the old one
+	if layoutChanged {
+		err := w.loadLayout()
+		if err != nil {
+			w.warn("Error:", err)
+		} else {
+			for name := range w.pages {
+				affected[name] = true
+			}
+			listChanged = true
+		}
+	}
+
+	// pages that were removed or turned into drafts
+	for name := range old.pages {
+		if !w.pages[name] {
+			w.removeOutput(w.outputPath(name))
+			listChanged = true
+			markLinking(name)
+		}
+	}
+
+	// pages that were added, or whose metadata shown in the list changed
+	for name := range w.pages {
+		if !old.pages[name] {
+			listChanged = true
+			markLinking(name)
+		} else if !reflect.DeepEqual(old.meta[name], w.meta[name]) {
+			listChanged = true
+		}
+
+		// the pages a page links to show its title in their backlinks
+		if old.title(name) != w.title(name) {
+			for _, page := range w.links[name] {
+				affected[page] = true
+			}
+		}
+	}
+
+	// tags that no longer have any pages
+	for tag := range old.tags {
+		if _, ok := w.tags[tag]; !ok {
+			w.removeOutput(w.outputPath(tagPage(tag)))
+		}
+	}
+
+	// pages whose links now point somewhere else, e.g. because an alias changed
+	for name := range w.pages {
+		if !slices.Equal(old.links[name], w.links[name]) {
+			affected[name] = true
+		}
+	}
+
+	// pages whose list of backlinks changed
+	for name, pages := range w.backlinks {
+		if !slices.Equal(pages, old.backlinks[name]) {
+			affected[name] = true
+		}
+	}
+	for name, pages := range old.backlinks {
+		if !slices.Equal(pages, w.backlinks[name]) {
+			affected[name] = true
+		}
+	}
+
+	// pages embedding an affected page, directly or through other pages
+	for changedEmbeds := true; changedEmbeds; {
+		changedEmbeds = false
+		for page, targets := range w.embeds {
+			if affected[page] {
+				continue
+			}
+			for _, target := range targets {
+				if affected[target] {
+					affected[page] = true
+					changedEmbeds = true
+					break
+				}
+			}
+		}
+	}
+
+	var files []string
+	for _, file := range w.files {
+		if affected[pageName(file)] {
+			files = append(files, file)
+		}
+	}
+
+	if len(files) > 0 || listChanged {
+		w.log("Rebuilding", len(files), "page(s)...")
+	}
+
+	w.renderAll(files, listChanged)
+
+	err = w.writeManifest()
+	if err != nil {
+		w.warn("Error:", err)
+	}
+	w.reportBroken()
+	w.reportEmbeds()
+
+	return w
+}
+
+// convert the given markdown files to HTML, and optionally the list of pages,
+// reporting the pages that fail instead of stopping
+func (w *wiki) renderAll(files []string, list bool) {
+
+	for i, err := range w.renderChanged(files) {
+		if err != nil {
+			w.warn(fmt.Sprintf("Error (%s):", files[i]), err)
+		}
+	}
+
+	// nothing else depends on the pages that were not changed
+	if len(files) == 0 && !list {
+		return
+	}
+
+	// the search index covers every page, so any change means writing it again
+	err := w.writeSearchIndex()
+	if err != nil {
+		w.warn("Error (search index):", err)
+	}
+
+	if list {
+		err := w.renderList()
+		if err != nil {
+			w.warn("Error (list):", err)
+		}
+	}
+
+	// tags can change with any page, so the tag pages are always regenerated
+	err = w.renderTags()
+	if err != nil {
+		w.warn("Error (tags):", err)
+	}
+}
+
+// copy a single image or static file to its place in the _site directory
+func (b *Builder) copyFile(file string) {
+
+	dst := b.copyPath(file)
+	err := copyFileAtomic(b.srcPath(file), dst)
+	if err != nil {
+		b.warn("Error (copy):", err)
+	} else {
+		b.record(dst)
+		b.log("Copied", file, "to", dst)
+	}
+}
+
+// remove a generated file from the _site directory
+func (b *Builder) removeOutput(path string) {
+
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		b.warn("Error (remove):", err)
+	} else if err == nil {
+		b.unrecord(path)
+		b.log("Removed", path)
+	}
+}
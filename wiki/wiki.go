@@ -0,0 +1,1233 @@
+package wiki
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"regexp"
+	"slices"
+	"strconv"
+	"unicode"
+	"encoding/base64"
+	stdhtml "html"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/parser"
+
+)
+
+// linkPlaceholderPattern matches the placeholders wiki links are replaced with
+// while the markdown is rendered
+const linkPlaceholderPattern = `mdwilink(\d+)x`
+
+var linkPlaceholderRegexp = regexp.MustCompile(linkPlaceholderPattern)
+
+// wikiLinkPattern matches wiki links such as {{Name}} or {{folder/Name}}, with
+// an optional heading and label, e.g. {{Name#Heading|label}}
+// names can contain anything but braces, | and #, but can't start with a space,
+// a dot or an exclamation mark so that things like {{ .Title }} are left alone
+const wikiLinkPattern = `\{\{([^{}|#!.\s][^{}|#\n]*)?(?:#([^{}|\n]+))?(?:\|([^{}\n]+))?\}\}`
+
+var wikiLinkRegexp = regexp.MustCompile(wikiLinkPattern)
+
+// imgTagRegexp matches the img tags of a rendered page, with their src attribute
+var imgTagRegexp = regexp.MustCompile(`(?i)<img\s+[^>]*src="([^"]+)"[^>]*>`)
+
+// wiki holds the information about the whole wiki that individual pages need,
+// read by the builder for a single build
+type wiki struct {
+	*Builder
+	files         []string                   // markdown files of the wiki
+	pages         map[string]bool            // page names relative to the wiki root, without the .md extension
+	folded        map[string]string          // lowercase page names mapped to the page names
+	outputs       map[string]string          // output names mapped to the page names generating them
+	links         map[string][]string        // page names mapped to the pages they link to
+	embeds        map[string][]string        // page names mapped to the pages they embed
+	backlinks     map[string][]string        // page names mapped to the pages that link to them
+	broken        []BrokenLink               // wiki links pointing at pages that don't exist
+	embedProblems []embedProblem             // embeds of existing pages that can't be rendered
+	meta          map[string]pageMeta        // page names mapped to their front matter
+	aliases       map[string]string          // alternative names of pages mapped to the page names
+	tags          map[string][]string        // tags mapped to the pages that have them
+	headings      map[string]map[string]bool // page names mapped to the IDs of their headings
+	anchors       map[string]string          // page names mapped to their section IDs in a --follow file
+	assets        map[string]bool            // files the pages link to that aren't pages, relative to the wiki root
+	assetFiles    []string                   // files with the asset extensions, relative to the wiki root
+	unused        []string                   // asset files no page links to
+	failed        []PageError                // pages that failed to load or render, and files that failed to copy
+	messages      *messages                  // messages of the page being rendered in parallel, printed later
+	siteKey       string                     // hash of the inputs shared by all the pages
+	sourceHashes  map[string]string          // page names mapped to the hashes of their markdown files
+}
+
+// create an empty wiki, read by the given builder
+func newWiki(b *Builder) *wiki {
+
+	w := &wiki{
+		Builder:   b,
+		pages:     make(map[string]bool),
+		folded:    make(map[string]string),
+		outputs:   make(map[string]string),
+		links:     make(map[string][]string),
+		embeds:    make(map[string][]string),
+		backlinks: make(map[string][]string),
+		meta:      make(map[string]pageMeta),
+		aliases:   make(map[string]string),
+		tags:      make(map[string][]string),
+		headings:  make(map[string]map[string]bool),
+		assets:    make(map[string]bool),
+
+		sourceHashes: make(map[string]string),
+	}
+	return w
+}
+
+// add a markdown file and its metadata to the wiki
+func (w *wiki) addPage(file string, meta pageMeta) {
+
+	name := pageName(file)
+
+	w.files = append(w.files, file)
+	w.pages[name] = true
+	w.meta[name] = meta
+
+	// the first page wins when names only differ in case
+	if _, ok := w.folded[strings.ToLower(name)]; !ok {
+		w.folded[strings.ToLower(name)] = name
+	}
+
+	// different names can end up with the same safe output name
+	if other, ok := w.outputs[outputName(name)]; ok {
+		w.warn("Warning:", other, "and", name, "are both written to", outputName(name)+".html")
+	}
+	w.outputs[outputName(name)] = name
+
+	for _, alias := range meta.Aliases {
+		alias = strings.ToLower(alias)
+		if other, ok := w.aliases[alias]; ok && other != name {
+			w.warn("Warning: alias", alias, "is used by both", other, "and", name)
+			continue
+		}
+		w.aliases[alias] = name
+	}
+}
+
+// get the title of a page from its front matter, falling back to the file name
+func (w *wiki) title(name string) string {
+
+	if title := w.meta[name].Title; title != "" {
+		return title
+	}
+	return path.Base(name)
+}
+
+// read all the markdown files and record which pages link to and embed which
+func (w *wiki) collectLinks() error {
+
+	for _, file := range w.files {
+
+		input, err := os.ReadFile(w.srcPath(file))
+		if err != nil {
+			return err
+		}
+
+		// links in the front matter don't count, invalid front matter is in w.failed
+		_, input, _ = splitFrontMatter(input)
+
+		page := pageName(file)
+		seen := make(map[string]bool)
+
+		for _, match := range wikiLinkRegexp.FindAllString(string(input), -1) {
+			name, heading, _ := splitLink(match)
+			if name == "" && heading == "" {
+				continue
+			}
+
+			// links with just a heading point at the same page
+			target := page
+			if name != "" {
+				target = w.resolveLink(page, name)
+			}
+
+			// record each missing heading once per file
+			if heading != "" && w.pages[target] && !w.headings[target][headingID(heading)] && !seen[target+"#"+heading] {
+				seen[target+"#"+heading] = true
+				w.broken = append(w.broken, BrokenLink{File: file, Target: target, Heading: heading})
+			}
+
+			if seen[target] {
+				continue
+			}
+			seen[target] = true
+			w.links[page] = append(w.links[page], target)
+
+			// record each missing page once per file
+			if !w.pages[target] {
+				w.broken = append(w.broken, BrokenLink{File: file, Target: target})
+			}
+
+			// skip links to self
+			if target == page {
+				continue
+			}
+			w.backlinks[target] = append(w.backlinks[target], page)
+		}
+
+		// record the embedded pages, so they can be checked and so that watch
+		// mode knows which pages to rebuild when an embedded page changes
+		for _, match := range embedRegexp.FindAllString(string(input), -1) {
+			name, heading := splitEmbed(match)
+			target := w.resolveLink(page, name)
+			if !slices.Contains(w.embeds[page], target) {
+				w.embeds[page] = append(w.embeds[page], target)
+			}
+			if heading != "" && w.pages[target] && !w.headings[target][headingID(heading)] && !seen[target+"#"+heading] {
+				seen[target+"#"+heading] = true
+				w.broken = append(w.broken, BrokenLink{File: file, Target: target, Heading: heading})
+			}
+			if !w.pages[target] && !seen[target] {
+				seen[target] = true
+				w.broken = append(w.broken, BrokenLink{File: file, Target: target})
+			}
+		}
+	}
+
+	return nil
+}
+
+// read all the markdown files and record the headings of every page, their
+// tags, from both the front matter and the inline tags, and the files they link to
+func (w *wiki) scanPages() error {
+
+	for _, file := range w.files {
+
+		input, err := os.ReadFile(w.srcPath(file))
+		if err != nil {
+			return err
+		}
+
+		// invalid front matter is in w.failed, the page just has no tags in it
+		meta, input, _ := splitFrontMatter(input)
+
+		name := pageName(file)
+		seen := make(map[string]bool)
+
+		// parse the page the same way markdownFile does, so the heading IDs match
+		input, _ = protectLinks(input)
+		doc := w.parseMarkdown(input)
+
+		w.headings[name] = make(map[string]bool)
+		ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+			if heading, ok := node.(*ast.Heading); ok && entering {
+				w.headings[name][heading.HeadingID] = true
+			}
+			if entering {
+				w.addAsset(file, node)
+			}
+			return ast.GoToNext
+		})
+
+		tags := append([]string{}, meta.Tags...)
+		tags = append(tags, inlineTags(doc)...)
+
+		for _, tag := range tags {
+			tag = normalizeTag(tag)
+			if tag == "" || seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			w.tags[tag] = append(w.tags[tag], name)
+		}
+	}
+
+	return nil
+}
+
+// convert a markdown file path into a page name (slash separated, no extension)
+func pageName(file string) string {
+	file = filepath.ToSlash(file)
+	return strings.TrimSuffix(file, filepath.Ext(file))
+}
+
+// find all files matching the pattern in the source directory and all its subdirectories
+// skipping the output directories and hidden directories, the paths are relative
+// to the source directory
+func (b *Builder) findFiles(pattern string) ([]string, error) {
+
+	var files []string
+
+	// the output directory can be anywhere inside the source directory, and so
+	// can the staging directory the build is written to
+	out, err := filepath.Abs(b.OutDir)
+	if err != nil {
+		return nil, err
+	}
+	target, err := filepath.Abs(b.target)
+	if err != nil || b.target == "" {
+		target = out
+	}
+
+	err = filepath.WalkDir(b.SrcDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path == b.SrcDir {
+				return nil
+			}
+			if d.Name() == "_site" || strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if filepath.Dir(path) == filepath.Clean(b.SrcDir) && slices.Contains(StaticDirs, d.Name()) {
+				return filepath.SkipDir // copied as they are by copyStatic
+			}
+			if rel, err := filepath.Rel(b.SrcDir, path); err == nil && matchGlobs(b.Config.Exclude, rel) {
+				return filepath.SkipDir
+			}
+			if abs, err := filepath.Abs(path); err == nil && (abs == out || abs == target) {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, ManifestFile)); err == nil {
+				return filepath.SkipDir // the output of another build
+			}
+			return nil
+		}
+
+		matched, err := filepath.Match(pattern, d.Name())
+		if err != nil {
+			return err
+		}
+		if matched {
+			rel, err := filepath.Rel(b.SrcDir, path)
+			if err != nil {
+				return err
+			}
+			if b.Config.includes(rel) {
+				files = append(files, rel)
+			}
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// open the _site directory and write the default stylesheet and favicon
+func (b *Builder) prepareSite() error {
+
+	err := b.openSite() // create _site directory
+	if err != nil {
+		return err
+	}
+
+	// write the default stylesheet to _site/style.css
+	stylesheet := b.Config.stylesheetString()
+	err = b.writeOutput("style.css", stylesheet)
+	if err != nil {
+		return fmt.Errorf("css write: %w", err)
+	}
+
+	// write the default favicon to _site/favicon.svg
+	favicon := generateFavicon()
+	if b.Config.favicon != nil {
+		favicon = string(b.Config.favicon)
+	}
+	err = b.writeOutput(b.Config.faviconName(), favicon)
+	if err != nil {
+		return fmt.Errorf("favicon write: %w", err)
+	}
+
+	// write the search box script to _site/search.js
+	search := generateSearchScript()
+	err = b.writeOutput("search.js", search)
+	if err != nil {
+		return fmt.Errorf("search write: %w", err)
+	}
+	return nil
+}
+
+// find all the markdown files in the current directory and its subdirectories
+// and collect the links between them
+func (b *Builder) loadWiki() (*wiki, error) {
+
+	files, err := b.findFiles("*.md")
+	if err != nil {
+		return nil, fmt.Errorf("md find: %w", err)
+	}
+
+	w := newWiki(b)
+
+	// read the front matter of every page, leaving out the drafts and the pages
+	// that can't be read, the failures are listed in w.failed
+	for _, file := range files {
+		input, err := os.ReadFile(b.srcPath(file))
+		if err != nil {
+			w.failed = append(w.failed, PageError{File: file, Err: err})
+			continue
+		}
+
+		// a page with invalid front matter is still part of the wiki, so that
+		// the links to it keep working while its previous HTML is kept
+		meta, _, err := splitFrontMatter(input)
+		if err != nil {
+			w.failed = append(w.failed, PageError{File: file, Err: err})
+			w.addPage(file, pageMeta{})
+			continue
+		}
+		if meta.Draft {
+			b.log("Skipped draft", file)
+			continue
+		}
+		w.addPage(file, meta)
+	}
+
+	// the headings need to be known before the links to them can be checked
+	err = w.scanPages()
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.collectLinks()
+	if err != nil {
+		return nil, err
+	}
+	w.checkEmbeds()
+
+	err = w.findAssets()
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// the html file in _site generated for the given page
+func (b *Builder) outputPath(name string) string {
+	return filepath.Join(b.OutDir, filepath.FromSlash(outputName(name))+".html")
+}
+
+// convert a page name into a name that is safe to use for a file and in a URL:
+// letters, numbers, dashes, underscores and dots are kept, anything else (spaces,
+// apostrophes, etc.) becomes a dash, folders are kept as they are
+func outputName(name string) string {
+
+	var base []rune
+	dash := false
+	for _, r := range path.Base(name) {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_' || r == '.' || r == '-' {
+			if dash && len(base) > 0 {
+				base = append(base, '-')
+			}
+			dash = false
+			base = append(base, r)
+		} else {
+			dash = true
+		}
+	}
+
+	// don't create hidden files
+	safe := strings.TrimLeft(string(base), ".")
+	if safe == "" {
+		safe = "page"
+	}
+
+	if folder := path.Dir(name); folder != "." {
+		return folder + "/" + safe
+	}
+	return safe
+}
+
+// convert a single markdown file of the wiki to HTML in the _site directory
+func (w *wiki) renderPage(file string) error {
+	name := pageName(file)
+	return w.markdownFile(w.srcPath(file), w.outputPath(name), name, false)
+}
+
+// generate the list of all pages and convert it to HTML in the _site directory
+func (w *wiki) renderList() error {
+	return w.generatedPage("list", w.generateList())
+}
+
+// print the links pointing at pages that don't exist
+func (w *wiki) reportBroken() {
+
+	if len(w.broken) == 0 {
+		return
+	}
+
+	w.warn("Found", len(w.broken), "broken wiki link(s):")
+	for _, link := range w.broken {
+		w.warn(" ", link)
+	}
+}
+
+// print the pages that failed to load and the files that failed to copy
+func (w *wiki) reportFailed() {
+	for _, page := range w.failed {
+		w.warn(fmt.Sprintf("Error (%s):", page.File), page.Err)
+	}
+}
+
+// the markdown files to render, leaving out the pages that failed to load
+func (w *wiki) renderFiles() []string {
+
+	var files []string
+	for _, file := range w.files {
+		if !slices.ContainsFunc(w.failed, func(page PageError) bool { return page.File == file }) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// keep the previous version of the pages that failed, if there is one
+func (w *wiki) keepFailed() {
+	for _, page := range w.failed {
+		path := w.outputPath(pageName(page.File))
+		if _, err := os.Stat(path); err == nil {
+			w.record(path)
+		}
+	}
+}
+
+// summarize the wiki for the caller of the builder
+func (w *wiki) report() *Report {
+	return &Report{Pages: len(w.files), Broken: w.broken, Unused: w.unused, Failed: w.failed}
+}
+
+// generate the markdown for the list of pages, grouped by folder
+func (w *wiki) generateList() string {
+
+	// pages grouped by the folder they live in, root pages use the "." key
+	folders := make(map[string][]string)
+	var folderNames []string
+
+	for _, file := range w.files {
+		name := pageName(file)
+		if name == "index" {
+			continue
+		}
+		folder := path.Dir(name)
+		if _, ok := folders[folder]; !ok {
+			folderNames = append(folderNames, folder)
+		}
+		folders[folder] = append(folders[folder], name)
+	}
+
+	var list_builder strings.Builder
+
+	list_builder.WriteString("---\ntitle: List of Pages\n---\n")
+	list_builder.WriteString("# List of Pages\n\n")
+
+	// pages in the root folder come first, without a heading
+	for _, name := range folders["."] {
+		list_builder.WriteString(w.listEntry(name))
+	}
+
+	sort.Strings(folderNames)
+	for _, folder := range folderNames {
+		if folder == "." {
+			continue
+		}
+		fmt.Fprintf(&list_builder, "\n## %s\n\n", escapeMarkdown(folder))
+		for _, name := range folders[folder] {
+			list_builder.WriteString(w.listEntry(name))
+		}
+	}
+
+	return list_builder.String()
+}
+
+// generate the markdown list item linking to a page, with its date if it has one
+func (w *wiki) listEntry(name string) string {
+
+	entry := fmt.Sprintf("- [%s](%s)", escapeMarkdown(w.title(name)), pageURL(name))
+	if date := w.meta[name].date(); date != "" {
+		entry += " *" + date + "*"
+	}
+	return entry + "\n"
+}
+
+// escape text written into generated markdown, e.g. a title from the front
+// matter, so that it shows up as it is: the characters markdown, HTML, wiki
+// links and tags give a meaning to are replaced with HTML entities
+func escapeMarkdown(text string) string {
+
+	var b strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune("\\`*_{}[]<>#&~^$", r) {
+			fmt.Fprintf(&b, "&#%d;", r)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// escape a slash separated page name so it can be used as a link to its html file
+func pageURL(name string) string {
+	segments := strings.Split(outputName(name), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/") + ".html"
+}
+
+// get the relative path from the page back to the root of the site, e.g. "../../"
+func rootPath(page string) string {
+	return strings.Repeat("../", strings.Count(page, "/"))
+}
+
+// resolve the target of a wiki link found on the given page to a page name
+// names are looked up in the folder of the page first and fall back to the
+// wiki root and then the page aliases, names starting with a slash are always
+// relative to the wiki root, case only matters when two pages differ by case
+func (w *wiki) resolveLink(page string, target string) string {
+
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(path.Clean(target), "/")
+		if name, ok := w.lookup(target); ok {
+			return name
+		}
+		return target
+	}
+
+	target = path.Clean(target)
+
+	if name, ok := w.lookup(path.Join(path.Dir(page), target)); ok {
+		return name
+	}
+	if name, ok := w.lookup(target); ok {
+		return name
+	}
+
+	// aliases declared in the front matter
+	if name, ok := w.aliases[strings.ToLower(target)]; ok {
+		return name
+	}
+
+	return target
+}
+
+// find the page with the given name, ignoring case if there is no exact match
+func (w *wiki) lookup(name string) (string, bool) {
+
+	if w.pages[name] {
+		return name, true
+	}
+	if page, ok := w.folded[strings.ToLower(name)]; ok {
+		return page, true
+	}
+	return "", false
+}
+
+// replace the wiki links in markdown content with placeholders, so that the
+// markdown renderer leaves them alone (e.g. doesn't turn ' into a curly quote),
+// returning the new content and the links in the order of the placeholders
+func protectLinks(input []byte) ([]byte, []string) {
+
+	var links []string
+	output := wikiLinkRegexp.ReplaceAllFunc(input, func(match []byte) []byte {
+		submatches := wikiLinkRegexp.FindSubmatch(match)
+		if len(bytes.TrimSpace(submatches[1])) == 0 && len(submatches[2]) == 0 {
+			return match
+		}
+		links = append(links, string(match))
+		return []byte(fmt.Sprintf("mdwilink%dx", len(links)-1))
+	})
+
+	return output, links
+}
+
+// replace the placeholders created by protectLinks using the replace function,
+// which gets the original wiki link
+func restoreLinks(content string, links []string, replace func(string) string) string {
+
+	return linkPlaceholderRegexp.ReplaceAllStringFunc(content, func(placeholder string) string {
+		i, err := strconv.Atoi(linkPlaceholderRegexp.FindStringSubmatch(placeholder)[1])
+		if err != nil || i >= len(links) {
+			return placeholder
+		}
+		return replace(links[i])
+	})
+}
+
+// split a wiki link such as {{Name#Heading|label}} into its parts, the label
+// defaults to the text of the link
+func splitLink(link string) (name string, heading string, label string) {
+
+	submatches := wikiLinkRegexp.FindStringSubmatch(link)
+	name, heading, label = strings.TrimSpace(submatches[1]), submatches[2], submatches[3]
+	if label == "" {
+		label = strings.TrimSuffix(link[2:len(link)-2], "|")
+	}
+	return name, heading, label
+}
+
+// convert a wiki link found on the given page into an HTML link
+// names may include folders, e.g. {{folder/Name}}, a heading, e.g. {{Name#Heading}}
+// and a label, e.g. {{Name|label}}
+func (w *wiki) linkHTML(link string, page string, root string, inline bool) string {
+
+	name, heading, label := splitLink(link)
+
+	// links with just a heading point at the same page
+	href := ""
+	target := page
+	if name != "" {
+		target = w.resolveLink(page, name)
+		href = root + pageURL(target)
+	}
+
+	// pages combined into a single file are sections of the same page
+	if anchor, ok := w.anchors[target]; ok {
+		href = "#" + anchor
+		if heading != "" {
+			href += "--" + headingID(heading)
+		}
+	} else if heading != "" {
+		href += "#" + headingID(heading)
+	}
+
+	// mark links to pages that don't exist, standalone files have no other pages to check
+	if !inline && !w.pages[target] {
+		return fmt.Sprintf("<a class=\"missing\" href=\"%s\">%s</a>", href, stdhtml.EscapeString(label))
+	}
+
+	return fmt.Sprintf("<a href=\"%s\">%s</a>", href, stdhtml.EscapeString(label))
+}
+
+// convert heading text into the ID generated for it by parser.AutoHeadingIDs:
+// lowercase letters and numbers, with runs of anything else turned into a dash
+func headingID(text string) string {
+
+	var id []rune
+	dash := false
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			if dash && len(id) > 0 {
+				id = append(id, '-')
+			}
+			dash = false
+			id = append(id, unicode.ToLower(r))
+		} else {
+			dash = true
+		}
+	}
+
+	if len(id) == 0 {
+		return "empty"
+	}
+	return string(id)
+}
+
+// parse markdown content into an AST using the extensions mdwi relies on
+func (b *Builder) parseMarkdown(input []byte) ast.Node {
+
+	// Create a new markdown parser with extensions
+	// the extensions can be changed in the config file
+	p := parser.NewWithExtensions(b.Config.parserExtensions())
+
+	return markdown.Parse(input, p)
+}
+
+// convert a markdown file to an HTML file, as the page with the given name
+// inline makes a standalone file
+func (w *wiki) markdownFile(inputPath string, outputPath string, name string, inline bool) error {
+
+	// Read the markdown file
+	input, err := os.ReadFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("md read: %w", err)
+	}
+
+	// relative path from this page to the root of the site, standalone files
+	// are always written to the root
+	page := &Page{
+		Name:       name,
+		Title:      pageName(filepath.Base(inputPath)),
+		Source:     inputPath,
+		Root:       rootPath(name),
+		Standalone: inline,
+		Backlinks:  w.backlinks[name],
+	}
+	if inline {
+		page.Root = ""
+	}
+
+	err = w.writePage(input, page, outputPath)
+	if err != nil {
+		return err
+	}
+
+	w.log("Converted", inputPath, "to", outputPath)
+	return nil
+}
+
+// convert the markdown of a page generated by mdwi, e.g. the list of pages, to
+// an HTML file in the _site directory, the markdown never touches the disk
+func (w *wiki) generatedPage(name string, input string) error {
+
+	outputPath := w.outputPath(name)
+	page := &Page{
+		Name:      name,
+		Title:     path.Base(name),
+		Root:      rootPath(name),
+		Backlinks: w.backlinks[name],
+	}
+
+	err := w.writePage([]byte(input), page, outputPath)
+	if err != nil {
+		return err
+	}
+
+	w.log("Generated", outputPath)
+	return nil
+}
+
+// render markdown to a finished HTML page and write it to outputPath, used by
+// both the markdown files of the wiki and the generated pages
+func (w *wiki) writePage(input []byte, page *Page, outputPath string) error {
+
+	output, err := w.renderMarkdown(input, page)
+	if err != nil {
+		return err
+	}
+
+	// make sure the folder for the output file exists
+	err = os.MkdirAll(filepath.Dir(outputPath), 0755)
+	if err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+
+	// Write the HTML output to the specified file
+	err = writeFileAtomic(outputPath, output)
+	if err != nil {
+		return fmt.Errorf("html write: %w", err)
+	}
+	w.record(outputPath)
+	return nil
+}
+
+// render the markdown of a page to a finished HTML page, the title of the page
+// is replaced by the one in the front matter if there is one
+func (w *wiki) renderMarkdown(input []byte, page *Page) ([]byte, error) {
+
+	// strip the front matter before rendering
+	meta, input, err := splitFrontMatter(input)
+	if err != nil {
+		return nil, err
+	}
+
+	// hide the embeds and wiki links from the markdown renderer
+	input, embeds := protectEmbeds(input)
+	input, links := protectLinks(input)
+
+	// Parse the markdown content
+	doc := w.parseMarkdown(input)
+
+	// link inline tags to their tag pages, standalone files have no tag pages
+	if !page.Standalone {
+		linkInlineTags(doc, page.Root)
+	}
+
+	// use the title from the front matter, or the file name
+	if meta.Title != "" {
+		page.Title = meta.Title
+	}
+
+	// Render the markdown to HTML
+	toc, body := renderDocument(doc)
+
+	// put the wiki links back in place of the placeholders, as <a href="Name.html">Name</a>,
+	// and the rendered embedded pages in place of theirs
+	restore := func(content string) string {
+		content = restoreLinks(content, links, func(link string) string {
+			return w.linkHTML(link, page.Name, page.Root, page.Standalone)
+		})
+		return restoreEmbeds(content, embeds, func(embed string) string {
+			return w.embedHTML(embed, page.Name, page.Root, page.Standalone, []string{page.Name})
+		})
+	}
+
+	// put the page into the layout, with the stylesheet, favicon, navigation and footer
+	contentStr, err := w.renderLayout(page, restore(toc), restore(body))
+	if err != nil {
+		return nil, err
+	}
+
+	return w.finishPage(contentStr, page)
+}
+
+func (b *Builder) inlineImages(content string, baseDir string) string {
+
+	b.log("Inlining images...")
+
+	// inline images by converting them to base64 and replacing the src attribute
+	contentStr := imgTagRegexp.ReplaceAllStringFunc(content, func(match string) string {
+		// extract the src attribute value
+		submatches := imgTagRegexp.FindStringSubmatch(match)
+		if len(submatches) < 2 {
+			return match // no src found, return original match
+		}
+		imgPath := submatches[1]
+
+		b.log("Found image:", imgPath)
+
+		// read the image file, relative paths are relative to the markdown file
+		imgFile := imgPath
+		if !filepath.IsAbs(imgFile) {
+			imgFile = filepath.Join(baseDir, imgFile)
+		}
+		imgData, err := os.ReadFile(imgFile)
+		if err != nil {
+			b.warn("Error (image read):", err)
+			return match // return original match if error occurs
+		}
+
+		// determine the image MIME type based on the file extension
+		var mimeType string
+		switch strings.ToLower(filepath.Ext(imgPath)) {
+		case ".png":
+			mimeType = "image/png"
+		case ".jpg", ".jpeg":
+			mimeType = "image/jpeg"
+		case ".gif":
+			mimeType = "image/gif"
+		case ".svg":
+			mimeType = "image/svg+xml"
+		default:
+			mimeType = "application/octet-stream" // fallback MIME type
+		}
+
+		// convert the image data to base64
+		base64Data := base64.StdEncoding.EncodeToString(imgData)
+
+		// create the new src attribute value
+		newSrc := fmt.Sprintf("data:%s;base64,%s", mimeType, base64Data)
+
+		// replace the src attribute in the original match with the new src
+		newMatch := strings.Replace(match, imgPath, newSrc, 1)
+		return newMatch
+	})
+
+	return contentStr
+}
+
+// the links at the top of the navigation sidebar
+func (conf Config) navLinks() []NavLink {
+	if len(conf.Nav) > 0 {
+		return conf.Nav
+	}
+	return []NavLink{
+		{Title: "🏠 Home", URL: "index.html"},
+		{Title: "📁 List", URL: "list.html"},
+		{Title: "🏷️ Tags", URL: "tags.html"},
+	}
+}
+
+// make a link URL from the config file relative to the page, unless it is
+// absolute or has a scheme such as https:
+func linkURL(link string, root string) string {
+	if strings.HasPrefix(link, "/") || strings.HasPrefix(link, "#") || strings.Contains(link, ":") {
+		return link
+	}
+	return root + link
+}
+
+func generateFavicon() string {
+	// create a default favicon
+	favicon := `<svg xmlns="http://www.w3.org/2000/svg" width="48" height="48" viewBox="0 0 20 16"><text x="0" y="14">📚</text></svg>`
+	return favicon
+}
+
+func generateStylesheetString(theme string) string {
+	// create a default stylesheet, with the colors of the theme
+	stylesheet := themeStylesheet(theme) + `
+
+body {
+    font-family: "Avenir Next", Helvetica, Arial, sans-serif;
+	margin: 2vw;
+    background: var(--background);
+    color: var(--text);
+
+	display: grid;
+	grid-template-columns: 1fr 3fr 1fr;
+	grid-template-rows: 1fr auto;
+	gap: 1vw;
+	padding: 1vw;
+}
+
+main {
+	grid-column: 2;
+	grid-row: 1;
+}
+
+nav {
+	grid-column: 1;
+	grid-row: 1;
+	top: 0;
+	position: sticky;
+	align-self: start;
+	font-size: 16px;
+}
+
+nav li {
+    padding: 0;
+    margin: 0
+}
+
+nav ul {
+    margin-top: 0;
+    margin-bottom: 0;
+    padding-left: 15px;
+
+}
+
+footer {
+	grid-column: 2;
+	grid-row: 2;
+
+    font-size: 10px;
+    margin-top: 1vw;
+    border-top: 1px solid var(--border);
+    text-align: right;
+}
+
+h1, h2, h3, h4, h5, h6 {
+	font-weight: bold;
+}
+
+h1 {
+	color: var(--heading);
+	font-size: 28pt;
+    border-bottom: 1px solid var(--border);
+}
+
+h2 {
+	border-bottom: 1px solid var(--border-light);
+	color: var(--heading);
+	font-size: 24px;
+}
+
+h3 {
+	font-size: 18px;
+	border-bottom: 1px solid var(--border-light);
+}
+
+h4, h5, h6 {
+	text-decoration: underline;
+}
+
+h4 {
+	font-size: 16px;
+}
+
+h5 {
+	font-size: 14px;
+}
+
+h6 {
+	color: var(--muted);
+	background-color: inherit;
+	font-size: 14px;
+}
+
+hr {
+	height: 0.2em;
+	border: 0;
+	color: var(--border-light);
+	background-color: var(--border-light);
+}
+
+p, blockquote, ul, ol, dl, li, table, pre {
+	margin: 15px 0;
+}
+
+a, a:visited {
+	color: var(--link);
+	background-color: inherit;
+	text-decoration: none;
+}
+
+#message {
+	border-radius: 6px;
+	border: 1px solid var(--border-light);
+	display:block;
+	width:100%;
+	height:60px;
+	margin:6px 0px;
+}
+
+button, #ws {
+	font-size: 10pt;
+	padding: 4px 6px;
+	border-radius: 5px;
+	border: 1px solid var(--input-border);
+	background-color: var(--button-background);
+	color: inherit;
+}
+
+code, pre, #ws, #message {
+	font-family: Monaco;
+	font-size: 10pt;
+	border-radius: 3px;
+	background-color: var(--code-background);
+	color: inherit;
+}
+
+code {
+	border: 1px solid var(--code-border);
+	margin: 0 2px;
+	padding: 0 5px;
+}
+
+pre {
+	border: 1px solid var(--border-light);
+	overflow: auto;
+	padding: 4px 8px;
+}
+
+pre > code {
+	border: 0;
+	margin: 0;
+	padding: 0;
+}
+
+img {
+    padding: 20px;
+    max-width: 80%;
+    height: auto;
+    width: auto\9;
+}
+
+td {
+    border: 1px solid var(--border-light);
+    padding-left: 10px;
+    padding-right: 10px;
+    min-width: 150px;
+}
+
+th {
+    border-bottom: 1px solid var(--heading);
+    padding-left: 10px;
+}
+
+del {
+    color: var(--muted);
+}
+
+em {
+    color: var(--accent);
+}
+
+figure {
+    border: 1px solid var(--border-light);
+    padding: 10px;
+    background-color: var(--code-background);
+    margin: 10px;
+}
+
+figcaption {
+    font-style: italic;
+    font-size: 12px;
+    color: var(--muted);
+}
+
+
+#ws { background-color: var(--code-background); }
+
+.send { color:#77bb77; }
+.server { color:#7799bb; }
+.error { color: var(--error); }
+
+.search input {
+	width: 100%;
+	box-sizing: border-box;
+	font-size: 14px;
+	padding: 4px 6px;
+	border-radius: 5px;
+	border: 1px solid var(--input-border);
+	background-color: var(--input-background);
+	color: inherit;
+}
+
+#search-results:empty {
+	display: none;
+}
+
+.embed {
+	border-left: 3px solid var(--border-light);
+	padding-left: 10px;
+}
+
+.embed-error {
+	color: var(--error);
+	border: 1px dashed var(--error);
+	padding: 4px 8px;
+}
+
+a.missing, a.missing:visited {
+	color: var(--error);
+	text-decoration: underline dashed;
+}
+
+
+@media print {
+    nav {
+        display: none !important;
+    }
+
+    h2 {
+        page-break-before: auto;
+        page-break-after: avoid;
+    }
+
+    h2, h3, h4 {
+        page-break-after: avoid;
+    }
+
+    img {
+        display: block;
+        margin-left: auto;
+        margin-right: auto;
+        width: 4.5in;
+        page-break-before: auto;
+        page-break-after: auto;
+        page-break-inside: avoid;
+    }
+
+    table {
+        page-break-before: auto;
+        page-break-after: auto;
+        page-break-inside: avoid;
+    }
+
+   a:link, a:visited {
+        text-decoration: underline
+   }
+
+   a:link:after, a:visited:after {
+       content: " (" attr(href) ") ";
+       font-size: 90%;
+   }
+
+}
+
+@media (max-width: 1100px) { 
+    nav {
+        margin-top: 2em;
+        left: 0;
+        position: relative;
+    }
+}`
+
+	return stylesheet
+}